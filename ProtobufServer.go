@@ -1,23 +1,37 @@
 package ci
 
 import (
+	"crypto/subtle"
 	"github.com/ericaro/ci/format"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 )
 
 //ProtobufServer is an independent http server that just exposes an http protobuf protocol
 type ProtobufServer struct {
 	daemon Daemon
+	Token  string // if not empty, requests must carry it as a bearer token
 }
 
-func NewProtobufServer(daemon Daemon) *ProtobufServer { return &ProtobufServer{daemon} }
+func NewProtobufServer(daemon Daemon) *ProtobufServer { return &ProtobufServer{daemon: daemon} }
 
 func (s *ProtobufServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Token != "" {
+		// the token must come with the bearer scheme, a bare token is rejected.
+		auth := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(auth, "Bearer ")
+		if token == auth || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+			format.ResponseWriterEncode(w, format.NewErrorResponse(format.Errorf(format.ErrorCode_UNAUTHORIZED, "a valid token is required.")))
+			return
+		}
+	}
 	// read any command
 	q := new(format.Request)
 	err := format.RequestDecode(q, r)
 	if err != nil {
-		http.Error(w, "http body must be of type protobuf Request: "+err.Error(), http.StatusBadRequest)
+		format.ResponseWriterEncode(w, format.NewErrorResponse(format.Errorf(format.ErrorCode_INVALID_ARGUMENT, "http body must be of type protobuf Request: %s", err.Error())))
 		return
 	}
 
@@ -38,19 +52,33 @@ func (s *ProtobufServer) Execute(q *format.Request) *format.Response {
 	daemon := s.daemon
 	switch {
 	case q.List != nil:
-		l := daemon.ListJobs(q.List.GetRefreshResult(), q.List.GetRefreshResult())
+		l := daemon.ListJobs(q.List.GetRefreshResult(), q.List.GetBuildResult(), q.List.GetHistory(), q.List.GetSelector())
 		return &format.Response{List: l}
 
 	case q.Log != nil:
-		j := daemon.JobDetails(q.Log.GetJobname())
+		j, err := daemon.JobDetails(q.Log.GetJobname())
+		if err != nil {
+			return format.NewErrorResponse(err)
+		}
 		return &format.Response{Log: j}
 
 	case q.Add != nil:
 		j := q.Add.Id
-		err := daemon.AddJob(j.GetName(), j.GetRemote(), j.GetBranch())
+		labels, err := format.LabelMap(j.GetLabels())
+		var env, secrets map[string]string
+		if err == nil {
+			env, err = format.VariableMap(j.GetEnv())
+		}
+		if err == nil {
+			secrets, err = format.SecretMap(j.GetSecrets())
+		}
+		if err != nil {
+			err = format.Errorf(format.ErrorCode_INVALID_ARGUMENT, "%s", err.Error())
+		} else {
+			err = daemon.AddJob(j.GetName(), j.GetRemote(), j.GetBranch(), labels, env, secrets)
+		}
 		if err != nil {
-			msg := err.Error()
-			return &format.Response{Error: &msg}
+			return format.NewErrorResponse(err)
 		}
 		// shedule a run after an Add
 		daemon.HeartBeats()
@@ -58,10 +86,101 @@ func (s *ProtobufServer) Execute(q *format.Request) *format.Response {
 	case q.Remove != nil:
 		err := daemon.RemoveJob(q.Remove.GetJobname())
 		if err != nil {
-			msg := err.Error()
-			return &format.Response{Error: &msg}
+			return format.NewErrorResponse(err)
+		}
+		return &format.Response{}
+	case q.Apply != nil:
+		a, err := daemon.ApplyJobs(q.Apply.GetJobs(), q.Apply.GetPrune(), q.Apply.GetDryrun())
+		if err != nil {
+			resp := format.NewErrorResponse(err)
+			resp.Apply = a
+			return resp
+		}
+		if !q.Apply.GetDryrun() && !a.Empty() {
+			log.Printf("daemon.apply:\n%s", a.Diff())
+			// shedule a run for new, and updated jobs
+			daemon.HeartBeats()
+		}
+		return &format.Response{Apply: a}
+	case q.Export != nil:
+		x := daemon.ExportJobs(q.Export.GetHistory())
+		return &format.Response{Export: x}
+	case q.Import != nil:
+		i, err := daemon.ImportJobs(q.Import.GetJobs(), q.Import.GetOverwrite())
+		if err != nil {
+			resp := format.NewErrorResponse(err)
+			resp.Import = i
+			return resp
+		}
+		if len(i.GetImported()) > 0 {
+			// shedule a run for imported jobs
+			daemon.HeartBeats()
+		}
+		return &format.Response{Import: i}
+	case q.Build != nil:
+		err := daemon.BuildJob(q.Build.GetJobname(), q.Build.GetForce())
+		if err != nil {
+			return format.NewErrorResponse(err)
+		}
+		return &format.Response{}
+	case q.Cancel != nil:
+		err := daemon.CancelJob(q.Cancel.GetJobname())
+		if err != nil {
+			return format.NewErrorResponse(err)
+		}
+		return &format.Response{}
+	case q.Wait != nil:
+		timeout := time.Duration(q.Wait.GetTimeout()) * time.Second
+		j, done, err := daemon.WaitJob(q.Wait.GetJobname(), q.Wait.GetVersion(), timeout)
+		if err != nil {
+			return format.NewErrorResponse(err)
+		}
+		return &format.Response{Wait: &format.WaitResponse{Job: j, Done: &done}}
+	case q.Watch != nil:
+		return &format.Response{Watch: daemon.WatchJobs(q.Watch)}
+	case q.Events != nil:
+		return &format.Response{Events: daemon.Events(q.Events)}
+	case q.AddHook != nil:
+		if err := daemon.AddHook(q.AddHook.GetHook()); err != nil {
+			return format.NewErrorResponse(err)
+		}
+		log.Printf("daemon.hook.added:%q", q.AddHook.GetHook().GetName())
+		return &format.Response{}
+	case q.RemoveHook != nil:
+		if err := daemon.RemoveHook(q.RemoveHook.GetName()); err != nil {
+			return format.NewErrorResponse(err)
+		}
+		log.Printf("daemon.hook.removed:%q", q.RemoveHook.GetName())
+		return &format.Response{}
+	case q.Hooks != nil:
+		return &format.Response{Hooks: daemon.Hooks(q.Hooks)}
+	case q.Redeliver != nil:
+		d, err := daemon.Redeliver(q.Redeliver.GetDelivery())
+		if err != nil {
+			return format.NewErrorResponse(err)
+		}
+		return &format.Response{Redeliver: &format.RedeliverResponse{Delivery: d}}
+	case q.AddCredential != nil:
+		if err := daemon.AddCredential(q.AddCredential.GetCredential()); err != nil {
+			return format.NewErrorResponse(err)
+		}
+		log.Printf("daemon.credential.added:%q", q.AddCredential.GetCredential().GetName())
+		return &format.Response{}
+	case q.RemoveCredential != nil:
+		if err := daemon.RemoveCredential(q.RemoveCredential.GetName()); err != nil {
+			return format.NewErrorResponse(err)
 		}
+		log.Printf("daemon.credential.removed:%q", q.RemoveCredential.GetName())
 		return &format.Response{}
+	case q.Credentials != nil:
+		return &format.Response{Credentials: &format.CredentialsResponse{Credentials: daemon.Credentials()}}
+	case q.Info != nil:
+		version, protocol := Version, int32(format.ProtocolVersion)
+		return &format.Response{Info: &format.InfoResponse{
+			Version:  &version,
+			Protocol: &protocol,
+			Features: format.Features,
+		}}
 	}
-	return nil
+	return format.NewErrorResponse(format.Errorf(format.ErrorCode_INVALID_ARGUMENT, format.UnknownRequest))
 }
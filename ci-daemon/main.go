@@ -4,15 +4,21 @@ import (
 	"flag"
 	"fmt"
 	"github.com/ericaro/ci"
+	"github.com/ericaro/ci/format"
 	"log"
 	"net/http"
 	"os"
 )
 
 var (
-	dbfile   = flag.String("o", "ci.db", "override the default local file name")
+	dbfile   = flag.String("o", "ci.db", "override the default local file name (the key to its secrets is <file>.key)")
 	port     = flag.Int("p", 2020, "override the default local port")
 	hookport = flag.Int("hp", 2121, "override the default hook port ")
+	config   = flag.String("config", "", "job file (yaml) to reconcile the jobs with at startup")
+	prune    = flag.Bool("prune", false, "with -config, remove jobs that are not in the job file")
+	token    = flag.String("token", os.Getenv("CI_TOKEN"), "token required from clients (default $CI_TOKEN), none if empty")
+	cert     = flag.String("cert", "", "TLS certificate file, to serve the protobuf api over https")
+	key      = flag.String("key", "", "TLS key file, with -cert")
 )
 
 func main() {
@@ -23,6 +29,7 @@ func main() {
 		log.Fatal(err.Error())
 	}
 
+	log.Printf("version:%s\n", ci.Version)
 	log.Printf("port:%v\n", *port)
 
 	log.Fatal(ListenAndServe(wd, *dbfile, *port))
@@ -35,6 +42,13 @@ func ListenAndServe(wd, dbfile string, port int) (err error) {
 		return err
 	}
 
+	if *config != "" {
+		if err = applyConfig(daemon, *config, *prune); err != nil {
+			log.Printf("error.startup.config:%q", err.Error())
+			return err
+		}
+	}
+
 	//launch the hook server in an independent gorutine.
 	go func() {
 		hook := ci.NewHookServer(daemon)
@@ -44,6 +58,29 @@ func ListenAndServe(wd, dbfile string, port int) (err error) {
 
 	log.Printf("startup.protoserver:%v", port)
 	pbs := ci.NewProtobufServer(daemon)
+	pbs.Token = *token
+	if *cert != "" {
+		return http.ListenAndServeTLS(fmt.Sprintf(":%v", port), *cert, *key, pbs)
+	}
 	return http.ListenAndServe(fmt.Sprintf(":%v", port), pbs)
 
 }
+
+//applyConfig reconciles the daemon's jobs with the job file.
+func applyConfig(daemon ci.Daemon, config string, prune bool) error {
+	f, err := format.ReadJobFile(config)
+	if err != nil {
+		return err
+	}
+	diff, err := daemon.ApplyJobs(f.Jobids(), prune, false)
+	if err != nil {
+		return err
+	}
+	if diff.Empty() {
+		log.Printf("config.uptodate:%q", config)
+		return nil
+	}
+	log.Printf("config.applied:%q\n%s", config, diff.Diff())
+	daemon.HeartBeats()
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/ericaro/ci/format"
+)
+
+//actions that can be triggered from a job page.
+const (
+	ActionBuild  = "build"  // run the job now
+	ActionForce  = "force"  // run the job now, and build even if the version has already been built
+	ActionCancel = "cancel" // stop the ongoing, or scheduled, run
+)
+
+//SessionCookie is the cookie that identifies a browser session, CSRF tokens are bound to it.
+const SessionCookie = "ci-session"
+
+//Actions returns true if actions are enabled: they require the -auth credentials.
+func (d *Dashboard) Actions() bool { return !d.ReadOnly && d.auth != "" }
+
+//Token returns the CSRF token for actions on the job 'name' of 'server', in the
+// browser 'session'.
+//
+// The token is signed with the dashboard secret, it cannot be forged by another
+// site, nor reused in another session.
+func (d *Dashboard) Token(session, server, name string) string {
+	mac := hmac.New(sha256.New, d.secret)
+	mac.Write([]byte(session + "\x00" + server + "\x00" + name))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+//session returns the browser session of the request, and starts a new one if
+// there is none.
+func session(w http.ResponseWriter, r *http.Request) (string, error) {
+	if c, err := r.Cookie(SessionCookie); err == nil && c.Value != "" {
+		return c.Value, nil
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    id,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return id, nil
+}
+
+//authorized returns true if the request carries the -auth credentials.
+func (d *Dashboard) authorized(r *http.Request) bool {
+	if d.auth == "" {
+		return false
+	}
+	user, password, ok := r.BasicAuth()
+	return ok && subtle.ConstantTimeCompare([]byte(user+":"+password), []byte(d.auth)) == 1
+}
+
+//sameOrigin returns false if the request does not come from the dashboard's own
+// pages: its Origin, or else its Referer, must be the dashboard.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+	if origin == "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+//ServeAction handles the "POST /action" form of job pages: "server", "job", "token",
+// and "action" (one of the Action*).
+//
+// The action is forwarded to the daemon, and the browser redirected to the job page.
+func (d *Dashboard) ServeAction(w http.ResponseWriter, r *http.Request) {
+	code, err := d.action(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		log.Printf("%s %v %s: %s", r.Method, code, r.URL.String(), err.Error())
+		return
+	}
+	log.Printf("%s %v %s", r.Method, code, r.URL.String())
+}
+
+//action does the actual job of ServeAction, it returns the http status, and the error if any.
+func (d *Dashboard) action(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !d.Actions() {
+		return http.StatusForbidden, fmt.Errorf("the dashboard is read-only")
+	}
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		return http.StatusMethodNotAllowed, fmt.Errorf("actions must be posted")
+	}
+	if !d.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="`+d.Title+`"`)
+		return http.StatusUnauthorized, fmt.Errorf("unauthorized")
+	}
+	servername, name := r.PostFormValue("server"), r.PostFormValue("job")
+	token := r.PostFormValue("token")
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil || !sameOrigin(r) || !hmac.Equal([]byte(token), []byte(d.Token(cookie.Value, servername, name))) {
+		return http.StatusForbidden, fmt.Errorf("invalid CSRF token")
+	}
+	server, ok := d.servers.Lookup(servername)
+	if !ok || servername == "" {
+		return http.StatusNotFound, fmt.Errorf("no such server %q", servername)
+	}
+
+	switch action := r.PostFormValue("action"); action {
+	case ActionBuild, ActionForce:
+		err = server.Client.BuildJob(r.Context(), name, action == ActionForce)
+	case ActionCancel:
+		err = server.Client.CancelJob(r.Context(), name)
+	default:
+		return http.StatusBadRequest, fmt.Errorf("unknown action %q", action)
+	}
+	if _, ok := err.(*format.UnsupportedError); ok {
+		return http.StatusNotImplemented, err
+	}
+	if e, ok := err.(*format.ServerError); ok {
+		if e.Code == format.ErrorCode_NOT_FOUND {
+			return http.StatusNotFound, err
+		}
+		return http.StatusConflict, err
+	}
+	if err != nil {
+		return http.StatusBadGateway, err
+	}
+	log.Printf("action %s on %s/%s", r.PostFormValue("action"), server.Name, name)
+
+	http.Redirect(w, r, Job{Server: server.Name, Name: name}.URL(), http.StatusSeeOther)
+	return http.StatusSeeOther, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"html/template"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//sgr matches ANSI "Select Graphic Rendition" escape sequences, like "\033[00;31m"
+var sgr = regexp.MustCompile("\033\\[([0-9;]*)m")
+
+//otherEscapes matches any other ANSI escape sequence, they are just dropped.
+var otherEscapes = regexp.MustCompile("\033\\[[0-9;?]*[A-Za-z]")
+
+//ANSIToHTML converts console output with ANSI colors into html.
+//
+// Colors and bold are converted into <span class="ansi-XX"> elements, where XX is
+// the SGR code (31 for red, 1 for bold, etc.). Everything else is escaped.
+func ANSIToHTML(txt string) template.HTML {
+	buf := new(bytes.Buffer)
+	open := 0 // number of open spans
+
+	closeAll := func() {
+		buf.WriteString(strings.Repeat("</span>", open))
+		open = 0
+	}
+
+	for {
+		loc := sgr.FindStringSubmatchIndex(txt)
+		if loc == nil {
+			break
+		}
+		buf.WriteString(escape(txt[:loc[0]]))
+		for _, code := range strings.Split(txt[loc[2]:loc[3]], ";") {
+			n, err := strconv.Atoi(code)
+			switch {
+			case err != nil || n == 0: // "" and "0" both mean reset
+				closeAll()
+			case n == 1 || (n >= 30 && n <= 37) || (n >= 90 && n <= 97) || (n >= 40 && n <= 47):
+				buf.WriteString(`<span class="ansi-` + strconv.Itoa(n) + `">`)
+				open++
+			}
+		}
+		txt = txt[loc[1]:]
+	}
+	buf.WriteString(escape(txt))
+	closeAll()
+	return template.HTML(buf.String())
+}
+
+func escape(txt string) string {
+	return html.EscapeString(otherEscapes.ReplaceAllString(txt, ""))
+}
+
+//ansiStyle is the css for ANSIToHTML classes.
+const ansiStyle = `
+	.ansi-1  { font-weight: bold; }
+	.ansi-30, .ansi-90 { color: #2E3436; }
+	.ansi-31, .ansi-91 { color: #CC0000; }
+	.ansi-32, .ansi-92 { color: #4E9A06; }
+	.ansi-33, .ansi-93 { color: #C4A000; }
+	.ansi-34, .ansi-94 { color: #3465A4; }
+	.ansi-35, .ansi-95 { color: #75507B; }
+	.ansi-36, .ansi-96 { color: #06989A; }
+	.ansi-37, .ansi-97 { color: #D3D7CF; }
+	.ansi-41 { background-color: #CC0000; }
+	.ansi-42 { background-color: #4E9A06; }
+	.ansi-43 { background-color: #C4A000; }
+	.ansi-44 { background-color: #3465A4; }
+`
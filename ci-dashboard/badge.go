@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/ericaro/ci/format"
+)
+
+//badge statuses, and their colors
+const (
+	BadgePassing = "passing"
+	BadgeFailing = "failing"
+	BadgeRunning = "running"
+	BadgeUnknown = "unknown"
+)
+
+var badgeColors = map[string]string{
+	BadgePassing: "#4C1",
+	BadgeFailing: "#E05D44",
+	BadgeRunning: "#007EC6",
+	BadgeUnknown: "#9F9F9F",
+}
+
+//BadgeStatus converts a job into a badge status.
+func BadgeStatus(j SJob) string {
+	if j.Unreachable {
+		return BadgeUnknown
+	}
+	s := j.State()
+	switch {
+	case s == format.JobStatus_SUCCESS:
+		return BadgePassing
+	case s.Failed():
+		return BadgeFailing
+	case s.Running() || s == format.JobStatus_QUEUED:
+		return BadgeRunning
+	default:
+		return BadgeUnknown
+	}
+}
+
+//AggregateBadgeStatus returns the badge status of a group of jobs: failing if any
+// is failing, then running if any is running, and passing only if all are passing.
+func AggregateBadgeStatus(jobs []SJob) string {
+	if len(jobs) == 0 {
+		return BadgeUnknown
+	}
+	counts := make(map[string]int)
+	for _, j := range jobs {
+		counts[BadgeStatus(j)]++
+	}
+	switch {
+	case counts[BadgeFailing] > 0:
+		return BadgeFailing
+	case counts[BadgeRunning] > 0:
+		return BadgeRunning
+	case counts[BadgePassing] == len(jobs):
+		return BadgePassing
+	default:
+		return BadgeUnknown
+	}
+}
+
+//ServeBadge serves "/badge/<job>.svg" for a single job, and "/badge.svg" for a
+// group of jobs: all of them, or those listed as "?job=a&job=b".
+//
+// An optional "?server=" restricts jobs to a single server, and "?label=" replaces
+// the text on the left.
+func (d *Dashboard) ServeBadge(w http.ResponseWriter, r *http.Request) {
+	jobs, _ := d.live.Jobs(r.URL.Query().Get("server"))
+
+	code := http.StatusOK
+	var label, status string
+	if r.URL.Path == "/badge.svg" {
+		label = "build"
+		selected := r.URL.Query()["job"]
+		if len(selected) > 0 {
+			jobs = filterByName(jobs, selected)
+			if len(jobs) < len(selected) {
+				code = http.StatusNotFound
+			}
+		}
+		status = AggregateBadgeStatus(jobs)
+	} else {
+		label = strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/badge/"), ".svg")
+		jobs = filterByName(jobs, []string{label})
+		if len(jobs) == 0 {
+			code = http.StatusNotFound
+		}
+		status = AggregateBadgeStatus(jobs)
+	}
+	if l := r.URL.Query().Get("label"); l != "" {
+		label = l
+	}
+
+	etag := fmt.Sprintf(`"%x"`, sha1.Sum([]byte(label+"\x00"+status)))
+	w.Header().Set("Content-Type", "image/svg+xml")
+	// badges are embedded in pages that are cached, make sure they are always checked.
+	w.Header().Set("Cache-Control", "no-cache, max-age=0, must-revalidate")
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(code)
+	if err := badge.Execute(w, NewBadge(label, status)); err != nil {
+		log.Printf("Error Rendering badge: %s", err.Error())
+	}
+	log.Printf("%s %v %s", r.Method, code, r.URL.String())
+}
+
+//filterByName returns the jobs whose name are in 'names'.
+func filterByName(jobs []SJob, names []string) (selected []SJob) {
+	set := make(map[string]bool)
+	for _, n := range names {
+		set[n] = true
+	}
+	for _, j := range jobs {
+		if set[j.GetId().GetName()] {
+			selected = append(selected, j)
+		}
+	}
+	return
+}
+
+//Badge is the host object for the badge template.
+type Badge struct {
+	Label, Status, Color string
+	LabelWidth, Width    int
+}
+
+//NewBadge computes the badge geometry.
+func NewBadge(label, status string) *Badge {
+	// approximation of the text width in Verdana 11px
+	lw, sw := 7*len(label)+10, 7*len(status)+10
+	return &Badge{
+		Label:      label,
+		Status:     status,
+		Color:      badgeColors[status],
+		LabelWidth: lw,
+		Width:      lw + sw,
+	}
+}
+
+//LabelX is the center of the label
+func (b *Badge) LabelX() int { return b.LabelWidth / 2 }
+
+//StatusX is the center of the status
+func (b *Badge) StatusX() int { return b.LabelWidth + (b.Width-b.LabelWidth)/2 }
+
+//StatusWidth is the width of the status
+func (b *Badge) StatusWidth() int { return b.Width - b.LabelWidth }
+
+// text/template does not escape, the label comes from the url: use the "html" func on texts.
+var badge = template.Must(template.New("").Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="20">
+	<linearGradient id="s" x2="0" y2="100%">
+		<stop offset="0" stop-color="#bbb" stop-opacity=".1"/>
+		<stop offset="1" stop-opacity=".1"/>
+	</linearGradient>
+	<rect rx="3" width="{{.Width}}" height="20" fill="#555"/>
+	<rect rx="3" x="{{.LabelWidth}}" width="{{.StatusWidth}}" height="20" fill="{{.Color}}"/>
+	<path fill="{{.Color}}" d="M{{.LabelWidth}} 0h4v20h-4z"/>
+	<rect rx="3" width="{{.Width}}" height="20" fill="url(#s)"/>
+	<g fill="#fff" text-anchor="middle" font-family="DejaVu Sans,Verdana,Geneva,sans-serif" font-size="11">
+		<text x="{{.LabelX}}" y="15" fill="#010101" fill-opacity=".3">{{html .Label}}</text>
+		<text x="{{.LabelX}}" y="14">{{html .Label}}</text>
+		<text x="{{.StatusX}}" y="15" fill="#010101" fill-opacity=".3">{{html .Status}}</text>
+		<text x="{{.StatusX}}" y="14">{{html .Status}}</text>
+	</g>
+</svg>
+`))
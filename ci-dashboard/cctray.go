@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/xml"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+//CCProjects is the root of the cc.xml feed, as read by CCMenu, CCTray and the like.
+type CCProjects struct {
+	XMLName  xml.Name    `xml:"Projects"`
+	Projects []CCProject `xml:"Project"`
+}
+
+//CCProject describes a single job in the cc.xml feed.
+type CCProject struct {
+	Name            string `xml:"name,attr"`
+	Activity        string `xml:"activity,attr"`        // Sleeping, Building
+	LastBuildStatus string `xml:"lastBuildStatus,attr"` // Success, Failure, Exception, Unknown
+	LastBuildLabel  string `xml:"lastBuildLabel,attr"`
+	LastBuildTime   string `xml:"lastBuildTime,attr"`
+	WebUrl          string `xml:"webUrl,attr"`
+}
+
+//NewCCProject converts a job, 'base' is the dashboard url, used to build the job page url.
+//
+// With 'multi' the project name is prefixed by the server name.
+func NewCCProject(base string, j SJob, multi bool) CCProject {
+	name := j.GetId().GetName()
+	build := j.GetBuild()
+	s := j.State()
+
+	p := CCProject{
+		Name:           name,
+		Activity:       "Sleeping",
+		LastBuildLabel: build.GetVersion(),
+		WebUrl:         base + "/job/" + url.PathEscape(name) + "?server=" + url.QueryEscape(j.Server),
+	}
+	if multi {
+		p.Name = j.Server + "/" + name
+	}
+	if s.Running() {
+		p.Activity = "Building"
+	}
+
+	// while running, the build execution still holds the last build outcome.
+	switch {
+	case j.Unreachable:
+		p.LastBuildStatus = "Unknown"
+	case s.Failed():
+		p.LastBuildStatus = "Failure"
+	case build.GetStart() == 0:
+		p.LastBuildStatus = "Unknown"
+	case build.GetErrcode() != 0:
+		p.LastBuildStatus = "Failure"
+	default:
+		p.LastBuildStatus = "Success"
+	}
+
+	t := build.GetEnd()
+	if t < build.GetStart() { // running
+		t = build.GetStart()
+	}
+	if t != 0 {
+		p.LastBuildTime = time.Unix(t, 0).Format(time.RFC3339)
+	}
+	return p
+}
+
+//ServeCCTray serves the cc.xml feed, "?server=" restricts it to a single server.
+func (d *Dashboard) ServeCCTray(w http.ResponseWriter, r *http.Request) {
+	server := r.URL.Query().Get("server")
+	jobs, _ := d.live.Jobs(server)
+	multi := len(d.servers) > 1 && server == ""
+
+	base := BaseURL(r)
+	feed := CCProjects{Projects: make([]CCProject, 0, len(jobs))}
+	for _, j := range jobs {
+		feed.Projects = append(feed.Projects, NewCCProject(base, j, multi))
+	}
+	sort.Sort(ccByName(feed.Projects))
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		log.Printf("Error Rendering cc.xml: %s", err.Error())
+		return
+	}
+	log.Printf("%s 200 %s", r.Method, r.URL.String())
+}
+
+//BaseURL returns the url of the dashboard, as seen by the client.
+func BaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+//ccByName to sort CCProject by their Name
+type ccByName []CCProject
+
+func (a ccByName) Len() int           { return len(a) }
+func (a ccByName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a ccByName) Less(i, j int) bool { return a[i].Name < a[j].Name }
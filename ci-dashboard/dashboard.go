@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"html/template"
+	"net/url"
 )
 
 //tmpl help wirting the "pure string below"
@@ -13,6 +14,23 @@ func tmpl(page string) *template.Template { return template.Must(template.New(""
 type Dashboard struct {
 	Title     string
 	JobMatrix [][]Job
+	Server    string // display only this server's jobs, if not empty
+	ReadOnly  bool   // true to disable actions on jobs
+	servers   ServerList
+	live      *Live  // shared view of the jobs
+	auth      string // "user:password" required for actions, they are disabled if empty
+	secret    []byte // signs CSRF tokens
+}
+
+//Multi returns true if the dashboard displays several servers, and therefore server labels.
+func (d *Dashboard) Multi() bool { return len(d.servers) > 1 && d.Server == "" }
+
+//EventsURL is the url of the server-sent events for this view.
+func (d *Dashboard) EventsURL() string {
+	if d.Server == "" {
+		return "/events"
+	}
+	return "/events?server=" + url.QueryEscape(d.Server)
 }
 
 func (d *Dashboard) NameFontSize() string {
@@ -53,17 +71,27 @@ func (d *Dashboard) VersionFontSize() string {
 }
 
 type Job struct {
+	Server  string // the server name
 	Name    string
 	Status  string //css class for it's status
 	Version string // a unique version (a sha1)
+	Stage   string // the stage that failed the build, if any
+}
+
+//Key uniquely identifies the job among all servers.
+func (j Job) Key() string { return j.Server + "/" + j.Name }
+
+//URL is the url of the job page.
+func (j Job) URL() string {
+	return "/job/" + url.PathEscape(j.Name) + "?server=" + url.QueryEscape(j.Server)
 }
 
 var dashboard = tmpl(`
 <!DOCTYPE html>
 	<html>
 	<head>
-	<meta http-equiv="refresh" content="10">
 	<title>{{.Title}}</title>
+	<link rel="alternate" type="application/atom+xml" title="{{.Title}}" href="/feed.atom">
 	<style>
 	html,body,table{
 		width:100%;
@@ -77,11 +105,16 @@ var dashboard = tmpl(`
 		font-size:{{.NameFontSize}};
 		text-align: center;
 	}
-	.version {
+	.version, .stage {
 		font-size:{{.VersionFontSize}};
 
 	}
-	.running {
+	td a {
+		color: inherit;
+		text-decoration: none;
+		display: block;
+	}
+	.queued, .pulling, .building {
 		color:  #F3F2D6;
 		background-color:  #0C00F3;
 
@@ -90,10 +123,22 @@ var dashboard = tmpl(`
 		color:  #0C00F3;
 		background-color:  #9FF8A5;
 	}
-	.failed {
+	.failed, .timed-out, .interrupted {
 		color:  #06052E;
 		background-color:  #FF9C9C;
 	}
+	.never-built, .idle, .cancelled {
+		color:  #06052E;
+		background-color:  #D8D8D8;
+	}
+	.unreachable {
+		color:  #F3F2D6;
+		background-color:  #555555;
+	}
+	.server {
+		font-size:{{.VersionFontSize}};
+		opacity: 0.6;
+	}
 
 </style>
 	</head>
@@ -104,15 +149,32 @@ var dashboard = tmpl(`
 			<tr>
 
 				{{range .}}
-				<td class="{{.Status}}">
-
+				<td id="job-{{.Key}}" class="{{.Status}}">
+					<a href="{{.URL}}">
+					{{if $.Multi}}<div class="server">{{.Server}}</div>{{end}}
 					<div>{{.Name}}</div>
 					<div class="version">{{.Version}}</div>
-
+					<div class="stage">{{if .Stage}}stage {{.Stage}} failed{{end}}</div>
+					</a>
 				</td>
 				{{end}}
 			</tr>
 			{{end}}
 
+		<script>
+		// cells are updated as the dashboard pushes changes, see Live.
+		var events = new EventSource("{{.EventsURL}}");
+		events.addEventListener("job", function(e) {
+			var job = JSON.parse(e.data);
+			var td = document.getElementById("job-" + job.Server + "/" + job.Name);
+			if (!td) {
+				return; // not in this view, new jobs come with a "reload" event.
+			}
+			td.className = job.Status;
+			td.querySelector(".version").textContent = job.Version;
+			td.querySelector(".stage").textContent = job.Stage ? "stage " + job.Stage + " failed" : "";
+		});
+		events.addEventListener("reload", function() { location.reload(); });
+		</script>
 	</body></html>
 	`)
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+//FeedSize is the maximum number of entries in a feed.
+const FeedSize = 50
+
+//FeedTag prefixes feed and entry ids. They are tag URIs (RFC 4151), so that
+// they do not depend on the address the dashboard is reached by.
+const FeedTag = "tag:ericaro.github.io,2026:ci"
+
+//AtomFeed is the root of an Atom feed.
+type AtomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Link    AtomLink    `xml:"link"`
+	Entries []AtomEntry `xml:"entry"`
+}
+
+//AtomEntry is a single build result in the feed.
+type AtomEntry struct {
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Link    AtomLink    `xml:"link"`
+	Author  AtomAuthor  `xml:"author"`
+	Content AtomContent `xml:"content"`
+	updated time.Time   // to sort entries
+}
+
+//AtomLink, AtomAuthor, and AtomContent are the Atom elements used by entries.
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type AtomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type AtomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+//NewAtomEntries converts a job's build history into feed entries.
+//
+// A build whose status differs from the previous one is flagged as a status change.
+func NewAtomEntries(title, base string, j SJob) []AtomEntry {
+	name := j.GetId().GetName()
+	link := base + "/job/" + url.PathEscape(name) + "?server=" + url.QueryEscape(j.Server)
+	history := j.GetHistory()
+
+	entries := make([]AtomEntry, 0, len(history))
+	for i, x := range history {
+		s := x.Outcome()
+		if s.Running() || x.GetStart() == 0 {
+			continue
+		}
+		end := time.Unix(x.GetEnd(), 0)
+		duration := time.Duration(x.GetEnd()-x.GetStart()) * time.Second
+
+		headline := fmt.Sprintf("%s: build %s", name, s.Label())
+		if i+1 < len(history) { // there is a previous build
+			if prev := history[i+1].Outcome(); prev != s {
+				headline = fmt.Sprintf("%s: build %s (was %s)", name, s.Label(), prev.Label())
+			}
+		}
+
+		entries = append(entries, AtomEntry{
+			Title:   headline,
+			ID:      fmt.Sprintf("%s/job/%s/%s/%d", FeedTag, url.PathEscape(j.Server), url.PathEscape(name), x.GetStart()),
+			Updated: end.Format(time.RFC3339),
+			Link:    AtomLink{Href: link},
+			Author:  AtomAuthor{Name: title},
+			Content: AtomContent{
+				Type: "text",
+				Body: fmt.Sprintf("%s %s in %s\nversion %s", name, s.Label(), duration, x.GetVersion()),
+			},
+			updated: end,
+		})
+	}
+	return entries
+}
+
+//ServeFeed serves "/feed.atom" for all jobs, and "/feed/<job>.atom" for a single job.
+//
+// "?server=" restricts the feed to a single server.
+func (d *Dashboard) ServeFeed(w http.ResponseWriter, r *http.Request) {
+	server := r.URL.Query().Get("server")
+	jobs, _ := d.live.Jobs(server)
+	base := BaseURL(r)
+	feed := AtomFeed{
+		Title: d.Title,
+		ID:    FeedTag + r.URL.RequestURI(),
+		Link:  AtomLink{Href: base + "/"},
+	}
+
+	if r.URL.Path != "/feed.atom" {
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/feed/"), ".atom")
+		jobs = filterByName(jobs, []string{name})
+		if len(jobs) == 0 {
+			http.Error(w, "no such job: "+name, http.StatusNotFound)
+			log.Printf("%s 404 %s", r.Method, r.URL.String())
+			return
+		}
+		feed.Title = name + " - " + d.Title
+		feed.Link.Href = base + "/job/" + url.PathEscape(name) + "?server=" + url.QueryEscape(jobs[0].Server)
+	}
+
+	for _, j := range jobs {
+		feed.Entries = append(feed.Entries, NewAtomEntries(d.Title, base, j)...)
+	}
+	sort.Sort(byUpdated(feed.Entries))
+	if len(feed.Entries) > FeedSize {
+		feed.Entries = feed.Entries[:FeedSize]
+	}
+	feed.Updated = time.Now().Format(time.RFC3339)
+	if len(feed.Entries) > 0 {
+		feed.Updated = feed.Entries[0].Updated
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		log.Printf("Error Rendering feed: %s", err.Error())
+		return
+	}
+	log.Printf("%s 200 %s", r.Method, r.URL.String())
+}
+
+//byUpdated to sort entries, most recent first.
+type byUpdated []AtomEntry
+
+func (a byUpdated) Len() int           { return len(a) }
+func (a byUpdated) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byUpdated) Less(i, j int) bool { return a[i].updated.After(a[j].updated) }
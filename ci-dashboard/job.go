@@ -0,0 +1,178 @@
+package main
+
+import (
+	"html/template"
+	"time"
+
+	"github.com/ericaro/ci/format"
+)
+
+//JobPage is the host object for a single job page.
+type JobPage struct {
+	Title   string
+	Server  string
+	Name    string
+	Remote  string
+	Branch  string
+	Labels  string // "key=value,..."
+	Status  string // css class for the job status
+	Label   string // human readable status
+	Active  bool   // true if the job is running, or scheduled
+	Token   string // CSRF token for actions, empty if actions are disabled
+	Refresh Exec
+	Build   Exec
+	Stages  []Exec
+	History []Exec
+}
+
+//Exec is the template friendly version of a format.Execution
+type Exec struct {
+	Name     string
+	Status   string // css class for it's status
+	Label    string // human readable status
+	Version  string
+	Start    time.Time
+	Duration time.Duration
+	Output   template.HTML // console output, with ANSI colors converted
+}
+
+//Started returns a human friendly version of the start date
+func (x Exec) Started() string {
+	if x.Start.IsZero() {
+		return "never"
+	}
+	return x.Start.Format("2006-01-02 15:04:05")
+}
+
+//NewJobPage converts a job (with details) into a JobPage
+func NewJobPage(title, server string, j *format.Job) *JobPage {
+	s := j.State()
+	p := &JobPage{
+		Title:   title,
+		Server:  server,
+		Name:    j.GetId().GetName(),
+		Remote:  j.GetId().GetRemote(),
+		Branch:  j.GetId().GetBranch(),
+		Labels:  format.LabelString(j.GetId().GetLabels()),
+		Status:  s.Class(),
+		Label:   s.Label(),
+		Active:  s.Running() || s == format.JobStatus_QUEUED,
+		Refresh: NewExec("refresh", j.GetRefresh()),
+		Build:   NewExec("build", j.GetBuild()),
+	}
+	for _, s := range j.GetStages() {
+		p.Stages = append(p.Stages, NewExec(s.GetName(), s.GetExecution()))
+	}
+	for _, x := range j.GetHistory() {
+		p.History = append(p.History, NewExec("build", x))
+	}
+	return p
+}
+
+//NewExec converts an execution.
+func NewExec(name string, x *format.Execution) Exec {
+	e := Exec{
+		Name:    name,
+		Status:  x.Outcome().Class(),
+		Label:   x.Outcome().Label(),
+		Version: x.GetVersion(),
+		Output:  ANSIToHTML(x.GetResult()),
+	}
+	if x.GetStart() != 0 {
+		e.Start = time.Unix(x.GetStart(), 0)
+	}
+	if x.GetEnd() >= x.GetStart() {
+		e.Duration = time.Duration(x.GetEnd()-x.GetStart()) * time.Second
+	} else { // still running
+		e.Duration = time.Since(e.Start) / time.Second * time.Second
+	}
+	return e
+}
+
+var jobpage = tmpl(`
+<!DOCTYPE html>
+	<html>
+	<head>
+	<title>{{.Name}} - {{.Title}}</title>
+	<link rel="alternate" type="application/atom+xml" title="{{.Name}} - {{.Title}}" href="/feed/{{.Name}}.atom?server={{.Server}}">
+	<style>
+	body {
+		font-family: "Courier New", Courier, monospace;
+		margin: 1em;
+	}
+	pre {
+		background-color: #F8F8F8;
+		padding: 1em;
+		overflow-x: auto;
+	}
+	td, th {
+		padding: 0.2em 1em;
+		text-align: left;
+	}
+	.status {
+		padding: 0.2em 0.5em;
+	}
+	.queued, .pulling, .building {
+		color:  #F3F2D6;
+		background-color:  #0C00F3;
+	}
+	.success {
+		color:  #0C00F3;
+		background-color:  #9FF8A5;
+	}
+	.failed, .timed-out, .interrupted {
+		color:  #06052E;
+		background-color:  #FF9C9C;
+	}
+	.never-built, .idle, .cancelled {
+		color:  #06052E;
+		background-color:  #D8D8D8;
+	}
+	` + ansiStyle + `
+	</style>
+	</head>
+	<body>
+		<a href="/">{{.Title}}</a>
+		<h1>{{.Name}} <span class="status {{.Status}}">{{.Label}}</span></h1>
+		<p>{{.Server}}: {{.Remote}} {{.Branch}}</p>
+		{{if .Labels}}<p>labels: {{.Labels}}</p>{{end}}
+		{{if .Token}}
+		<form method="post" action="/action">
+			<input type="hidden" name="server" value="{{.Server}}">
+			<input type="hidden" name="job" value="{{.Name}}">
+			<input type="hidden" name="token" value="{{.Token}}">
+			<button name="action" value="build">rebuild</button>
+			<button name="action" value="force" title="build even if the version has already been built">force rebuild</button>
+			{{if .Active}}<button name="action" value="cancel">cancel</button>{{end}}
+		</form>
+		{{end}}
+
+		{{with .Refresh}}
+		<h2>{{.Name}} <span class="status {{.Status}}">{{.Label}}</span></h2>
+		<p>started {{.Started}}, took {{.Duration}}, version {{.Version}}</p>
+		<pre>{{.Output}}</pre>
+		{{end}}
+
+		{{with .Build}}
+		<h2>{{.Name}} <span class="status {{.Status}}">{{.Label}}</span></h2>
+		<p>started {{.Started}}, took {{.Duration}}, version {{.Version}}</p>
+		{{end}}
+		{{if .Stages}}
+		<table>
+			<tr><th>stage</th><th>status</th><th>duration</th></tr>
+			{{range .Stages}}
+			<tr><td>{{.Name}}</td><td class="status {{.Status}}">{{.Label}}</td><td>{{.Duration}}</td></tr>
+			{{end}}
+		</table>
+		{{end}}
+		<pre>{{.Build.Output}}</pre>
+
+		<h2>history</h2>
+		<table>
+			<tr><th>started</th><th>status</th><th>duration</th><th>version</th></tr>
+			{{range .History}}
+			<tr><td>{{.Started}}</td><td class="status {{.Status}}">{{.Label}}</td><td>{{.Duration}}</td><td>{{.Version}}</td></tr>
+			{{end}}
+		</table>
+	</body></html>
+	`)
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ericaro/ci/format"
+	"github.com/golang/protobuf/proto"
+)
+
+//Live keeps a single, shared, view of the daemons' jobs, and pushes changes to
+// subscribers (browsers, through server-sent events).
+type Live struct {
+	servers ServerList
+	mu      sync.Mutex
+	states  map[string]*serverState // server name -> last fetch
+	cells   map[string]Job          // last known cell for each job key
+	subs    map[chan Event]string   // subscribers, and their server filter
+}
+
+//serverState is the result of the last fetch on a server.
+type serverState struct {
+	jobs []*format.Job // last known jobs, kept when the server is down
+	err  error         // last fetch error
+}
+
+//Event is a change pushed to subscribers.
+type Event struct {
+	Name string // "job" when a cell has changed, "reload" when the job list has changed.
+	Job  Job
+}
+
+//longPoll is the timeout of watch requests.
+const longPoll = 30 * time.Second
+
+//NewLive creates a Live, and starts watching the daemons. Daemons that do not
+// support watch requests are polled every 'period', so are the ones that are down.
+func NewLive(servers ServerList, period time.Duration) *Live {
+	l := &Live{
+		servers: servers,
+		states:  make(map[string]*serverState),
+		cells:   make(map[string]Job),
+		subs:    make(map[chan Event]string),
+	}
+	l.update()
+	for _, s := range servers {
+		go l.watch(s, period)
+	}
+	return l
+}
+
+//watch keeps the jobs of 's' up to date, with watch requests.
+func (l *Live) watch(s Server, period time.Duration) {
+	var revision uint64 // the first response has all the jobs
+	jobs := make(map[string]*format.Job)
+	for {
+		resp, err := s.Client.WatchJobs(context.Background(), &format.WatchRequest{
+			Revision: &revision,
+			Timeout:  proto.Int64(int64(longPoll / time.Second)),
+			History:  proto.Bool(true),
+		})
+		if _, ok := err.(*format.UnsupportedError); ok {
+			log.Printf("%s, polling it every %s", err.Error(), period)
+			l.poll(s, period)
+			return
+		}
+		if err != nil {
+			log.Printf("error watching jobs from %s: %s", s.Name, err.Error())
+			l.set(s, nil, err)
+			time.Sleep(period)
+			continue
+		}
+		if resp.GetFull() {
+			jobs = make(map[string]*format.Job)
+		}
+		for _, j := range resp.GetJobs() {
+			jobs[j.GetId().GetName()] = j
+		}
+		for _, name := range resp.GetRemoved() {
+			delete(jobs, name)
+		}
+		revision = resp.GetRevision()
+
+		list := make([]*format.Job, 0, len(jobs))
+		for _, j := range jobs {
+			list = append(list, j)
+		}
+		l.set(s, list, nil)
+	}
+}
+
+//poll fetches the jobs of 's' every 'period', forever.
+func (l *Live) poll(s Server, period time.Duration) {
+	for _ = range time.Tick(period) {
+		jobs, err := s.Client.ListJobs(context.Background(), false, false, true, nil)
+		if err != nil {
+			log.Printf("error getting jobs from %s: %s", s.Name, err.Error())
+		}
+		l.set(s, jobs, err)
+	}
+}
+
+//set records the jobs of 's', or the error getting them, and broadcasts the cells that have changed.
+func (l *Live) set(s Server, jobs []*format.Job, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st := serverState{jobs: jobs, err: err}
+	if old, exists := l.states[s.Name]; exists && err != nil {
+		st.jobs = old.jobs // keep the last known jobs, until the server is back
+	}
+	l.states[s.Name] = &st
+	l.publish()
+}
+
+//Jobs returns the last fetched jobs of the server called 'server', or of all
+// servers if empty.
+//
+// Jobs of a server that is down are in their last known state, and flagged Unreachable.
+// Servers that are down and have never been reached are listed in 'down'.
+func (l *Live) Jobs(server string) (jobs []SJob, down []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, s := range l.servers {
+		if server != "" && s.Name != server {
+			continue
+		}
+		st := l.states[s.Name]
+		if st.err != nil && len(st.jobs) == 0 {
+			down = append(down, s.Name)
+		}
+		for _, j := range st.jobs {
+			jobs = append(jobs, SJob{Server: s.Name, Unreachable: st.err != nil, Job: j})
+		}
+	}
+	return
+}
+
+//update fetches the jobs of all servers concurrently, and broadcasts the cells that have changed.
+func (l *Live) update() {
+	states := make([]serverState, len(l.servers))
+	var wg sync.WaitGroup
+	for i, s := range l.servers {
+		wg.Add(1)
+		go func(i int, s Server) {
+			defer wg.Done()
+			states[i].jobs, states[i].err = s.Client.ListJobs(context.Background(), false, false, true, nil)
+			if states[i].err != nil {
+				log.Printf("error getting jobs from %s: %s", s.Name, states[i].err.Error())
+			}
+		}(i, s)
+	}
+	wg.Wait()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, s := range l.servers {
+		st := states[i]
+		if old, exists := l.states[s.Name]; exists && st.err != nil {
+			st.jobs = old.jobs // keep the last known jobs, until the server is back
+		}
+		l.states[s.Name] = &st
+	}
+	l.publish()
+}
+
+//publish computes the cells of all servers, and broadcasts the ones that have changed. l.mu must be held.
+func (l *Live) publish() {
+	cells := make(map[string]Job)
+	var events []Event
+	for _, s := range l.servers {
+		st := l.states[s.Name]
+		if st.err != nil && len(st.jobs) == 0 {
+			c := UnreachableJob(s.Name)
+			cells[c.Key()] = c
+		}
+		for _, v := range st.jobs {
+			c := NewJob(SJob{Server: s.Name, Unreachable: st.err != nil, Job: v})
+			cells[c.Key()] = c
+			if old, exists := l.cells[c.Key()]; !exists || old != c {
+				events = append(events, Event{Name: "job", Job: c})
+			}
+		}
+	}
+	if len(cells) != len(l.cells) || hasNew(l.cells, cells) {
+		events = []Event{{Name: "reload"}} // the grid itself has changed
+	}
+	l.cells = cells
+
+	for ch, server := range l.subs {
+		for _, e := range events {
+			if e.Name == "job" && server != "" && e.Job.Server != server {
+				continue
+			}
+			select {
+			case ch <- e:
+			default:
+				log.Printf("dropping event for a slow subscriber")
+			}
+		}
+	}
+}
+
+//hasNew returns true if 'cells' contains a job not in 'old'
+func hasNew(old, cells map[string]Job) bool {
+	for key := range cells {
+		if _, exists := old[key]; !exists {
+			return true
+		}
+	}
+	return false
+}
+
+//Subscribe returns a channel that receives all future events, for the server
+// called 'server', or all if empty.
+func (l *Live) Subscribe(server string) chan Event {
+	ch := make(chan Event, 64)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.subs[ch] = server
+	return ch
+}
+
+//Unsubscribe stops sending events to 'ch'.
+func (l *Live) Unsubscribe(ch chan Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.subs, ch)
+}
+
+//ServeEvents streams events to the browser, as server-sent events.
+//
+// "?server=" restricts the events to a single server.
+func (l *Live) ServeEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	ch := l.Subscribe(r.URL.Query().Get("server"))
+	defer l.Unsubscribe(ch)
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case e := <-ch:
+			b, err := json.Marshal(e.Job)
+			if err != nil {
+				log.Printf("error encoding event: %s", err.Error())
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Name, b)
+		}
+		flusher.Flush()
+	}
+}
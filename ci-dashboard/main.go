@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/rand"
 	"flag"
 	"fmt"
 	"github.com/ericaro/ci/format"
@@ -8,23 +9,45 @@ import (
 	"math"
 	"net/http"
 	"sort"
+	"strings"
 	"time"
 )
 
 var (
-	server = flag.String("s", "http://localhost:2020", "remote server address")
-	title  = flag.String("t", "CI Dashboard", "CI title")
-	port   = flag.Int("p", 8080, "http port to listen to")
-	prop   = flag.Float64("prop", 4, "cell width ~= prop*cell height")
+	servers ServerList // -s
+	title   = flag.String("t", "CI Dashboard", "CI title")
+	port    = flag.Int("p", 8080, "http port to listen to")
+	prop    = flag.Float64("prop", 4, "cell width ~= prop*cell height")
+	poll    = flag.Duration("poll", 2*time.Second, "period between two polls of the remote servers that do not support watch requests, or are down")
+	ro      = flag.Bool("readonly", false, "disable actions (build, cancel) on job pages, even with -auth")
+	auth    = flag.String("auth", "", "'user:password' required to trigger actions (build, cancel) on job pages, with http basic authentication. Actions are disabled without it")
 )
 
+func init() {
+	flag.Var(&servers, "s", "remote server address, as 'url' or 'name=url' (repeatable, default http://localhost:2020)")
+}
+
 func main() {
 	flag.Parse()
+	if len(servers) == 0 {
+		servers.Set("http://localhost:2020")
+	}
 
 	log.Printf("dashboard available at http://locahost:%v\n", *port)
 
 	d := new(Dashboard)
 	d.Title = *title
+	d.servers = servers
+	d.live = NewLive(servers, *poll)
+	d.ReadOnly = *ro
+	d.auth = *auth
+	d.secret = make([]byte, 32)
+	if _, err := rand.Read(d.secret); err != nil {
+		log.Fatalf("cannot generate the CSRF secret: %s", err.Error())
+	}
+	if !d.ReadOnly && d.auth == "" {
+		log.Printf("actions on jobs are disabled, use -auth to enable them")
+	}
 	http.ListenAndServe(fmt.Sprintf(":%v", *port), d)
 }
 
@@ -37,10 +60,47 @@ func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			log.Printf("%s 501 %s", r.Method, r.URL.String())
 			return
 		}
-
+		return
 	}
-	d.JobMatrix = d.FillJobMatrix()
-	err := dashboard.Execute(w, d)
+	if r.URL.Path == "/events" {
+		d.live.ServeEvents(w, r)
+		return
+	}
+	if r.URL.Path == "/cc.xml" {
+		d.ServeCCTray(w, r)
+		return
+	}
+	if r.URL.Path == "/feed.atom" || strings.HasPrefix(r.URL.Path, "/feed/") {
+		d.ServeFeed(w, r)
+		return
+	}
+	if r.URL.Path == "/badge.svg" || strings.HasPrefix(r.URL.Path, "/badge/") {
+		d.ServeBadge(w, r)
+		return
+	}
+	if r.URL.Path == "/action" {
+		d.ServeAction(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/job/") {
+		d.ServeJob(w, r, strings.TrimPrefix(r.URL.Path, "/job/"))
+		return
+	}
+	// each request has its own view of the dashboard
+	v := *d
+	v.Server = r.URL.Query().Get("server")
+	var selector []*format.Label
+	for _, l := range r.URL.Query()["label"] {
+		labels, err := format.ParseLabels(l)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			log.Printf("%s 400 %s", r.Method, r.URL.String())
+			return
+		}
+		selector = append(selector, labels...)
+	}
+	v.JobMatrix = d.FillJobMatrix(v.Server, selector)
+	err := dashboard.Execute(w, &v)
 	if err != nil {
 		log.Printf("Error Rendering template: %s", err.Error())
 		http.Error(w, "template error: "+err.Error(), http.StatusInternalServerError)
@@ -50,25 +110,69 @@ func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	log.Printf("%s 200 %s", r.Method, r.URL.String())
 }
 
-func (d *Dashboard) FillJobMatrix() (jobs [][]Job) {
-	jobin, err := GetJobs()
+//ServeJob renders the page of a single job, "?server=" selects the server (the first one by default).
+func (d *Dashboard) ServeJob(w http.ResponseWriter, r *http.Request, name string) {
+	server, ok := d.servers.Lookup(r.URL.Query().Get("server"))
+	if !ok {
+		http.Error(w, "no such server", http.StatusNotFound)
+		log.Printf("%s 404 %s", r.Method, r.URL.String())
+		return
+	}
+	j, err := server.Client.Job(r.Context(), name)
+	if format.Code(err) == format.ErrorCode_NOT_FOUND {
+		http.Error(w, "no such job "+name, http.StatusNotFound)
+		log.Printf("%s 404 %s", r.Method, r.URL.String())
+		return
+	}
 	if err != nil {
-		log.Printf("error getting jobs: %s", err.Error())
-		return //empty matrix, if no server communication
+		log.Printf("error getting job %q: %s", name, err.Error())
+		http.Error(w, "cannot get job "+name+": "+err.Error(), http.StatusBadGateway)
+		log.Printf("%s 502 %s", r.Method, r.URL.String())
+		return
+	}
+	p := NewJobPage(d.Title, server.Name, j)
+	if d.Actions() {
+		id, err := session(w, r)
+		if err != nil {
+			log.Printf("error starting a session: %s", err.Error())
+			http.Error(w, "cannot start a session: "+err.Error(), http.StatusInternalServerError)
+			log.Printf("%s 500 %s", r.Method, r.URL.String())
+			return
+		}
+		p.Token = d.Token(id, server.Name, p.Name)
+	}
+	err = jobpage.Execute(w, p)
+	if err != nil {
+		log.Printf("Error Rendering template: %s", err.Error())
+		http.Error(w, "template error: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("%s 501 %s", r.Method, r.URL.String())
+		return
+	}
+	log.Printf("%s 200 %s", r.Method, r.URL.String())
+}
+
+//FillJobMatrix lays out the jobs of the server called 'server' (all servers if empty),
+// that have all the labels in 'selector'.
+//
+// Servers that cannot be reached are displayed with their last known jobs, or a
+// single "unreachable" cell.
+func (d *Dashboard) FillJobMatrix(server string, selector []*format.Label) (jobs [][]Job) {
+	jobin, down := d.live.Jobs(server)
+	if len(selector) > 0 {
+		jobin = filterByLabels(jobin, selector)
 	}
 	//skip trival case
-	if len(jobin) == 0 {
+	if len(jobin)+len(down) == 0 {
 		return nil
 	}
 	//format all jobs into a local type list
-	joblist := make([]Job, 0, len(jobin))
+	joblist := make([]Job, 0, len(jobin)+len(down))
 
 	for _, v := range jobin {
-		joblist = append(joblist, Job{
-			Status:  Status(v), //todo fill it
-			Name:    v.GetId().GetName(),
-			Version: v.GetBuild().GetVersion(),
-		})
+		joblist = append(joblist, NewJob(v))
+	}
+	for _, s := range down {
+		joblist = append(joblist, UnreachableJob(s))
 	}
 
 	//sort by anme
@@ -101,35 +205,51 @@ func (d *Dashboard) FillJobMatrix() (jobs [][]Job) {
 	return
 }
 
-func Status(j *format.Job) string {
+//filterByLabels returns the jobs that have all the labels in 'selector'.
+func filterByLabels(jobs []SJob, selector []*format.Label) (selected []SJob) {
+	for _, j := range jobs {
+		if j.GetId().Matches(selector) {
+			selected = append(selected, j)
+		}
+	}
+	return
+}
 
-	var zero, rstart, rend, bstart, bend time.Time
+//NewJob converts a job into a grid cell.
+func NewJob(v SJob) Job {
+	return Job{
+		Server:  v.Server,
+		Status:  Status(v),
+		Name:    v.GetId().GetName(),
+		Version: v.GetBuild().GetVersion(),
+		Stage:   FailedStage(v.Job),
+	}
+}
+
+//UnreachableJob is the cell for a server that has never been reached.
+func UnreachableJob(server string) Job {
+	return Job{Server: server, Name: server, Status: Unreachable}
+}
 
-	rstart = time.Unix(j.Refresh.GetStart(), 0)
-	rend = time.Unix(j.Refresh.GetEnd(), 0)
-	bstart = time.Unix(j.Build.GetStart(), 0)
-	bend = time.Unix(j.Build.GetEnd(), 0)
+//Unreachable is the css class of jobs whose server cannot be reached.
+const Unreachable = "unreachable"
 
-	switch {
-	case zero.Equal(rstart) || zero.Equal(bstart) || rstart.After(rend) || bstart.After(bend):
-		return "running"
-	case j.GetRefresh().GetErrcode() == 0 && j.GetBuild().GetErrcode() == 0:
-		return "success"
-	default:
-		return "failed"
+//Status returns the css class for the job status.
+func Status(j SJob) string {
+	if j.Unreachable {
+		return Unreachable
 	}
+	return j.State().Class()
 }
 
-//GetJobs just make the http request
-func GetJobs() ([]*format.Job, error) {
-	req := &format.Request{List: &format.ListRequest{}}
-
-	c := format.NewClient(*server)
-	resp, err := c.Proto(req)
-	if err != nil {
-		return nil, err
+//FailedStage returns the name of the stage that failed the build, if any.
+func FailedStage(j *format.Job) string {
+	for _, s := range j.GetStages() {
+		if s.GetExecution().GetErrcode() != 0 && !s.GetAllowFailure() {
+			return s.GetName()
+		}
 	}
-	return resp.GetList().GetJobs(), nil
+	return ""
 }
 
 //byName to sort any slice of Execution by their Name !
@@ -137,4 +257,4 @@ type byName []Job
 
 func (a byName) Len() int           { return len(a) }
 func (a byName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a byName) Less(i, j int) bool { return a[i].Name < a[j].Name }
+func (a byName) Less(i, j int) bool { return a[i].Key() < a[j].Key() }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ericaro/ci/format"
+)
+
+//Server is a ci daemon displayed in the dashboard.
+type Server struct {
+	Name   string // label displayed in the dashboard
+	URL    string
+	Client *format.Client
+}
+
+//ServerList is a flag.Value accepting several "-s name=url" (or just "-s url").
+type ServerList []Server
+
+func (l *ServerList) String() string {
+	s := make([]string, 0, len(*l))
+	for _, v := range *l {
+		s = append(s, v.Name+"="+v.URL)
+	}
+	return strings.Join(s, ",")
+}
+
+func (l *ServerList) Set(v string) error {
+	var s Server
+	if i := strings.Index(v, "="); i > 0 && !strings.Contains(v[:i], "/") {
+		s.Name, s.URL = v[:i], v[i+1:]
+	} else {
+		s.URL = v
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid server url %q", s.URL)
+	}
+	if s.Name == "" {
+		s.Name = u.Host
+	}
+	s.Client = format.NewClient(s.URL)
+	for _, x := range *l {
+		if x.Name == s.Name {
+			return fmt.Errorf("server %q is declared twice", s.Name)
+		}
+	}
+	*l = append(*l, s)
+	return nil
+}
+
+//Lookup returns the server called 'name', or the first one if 'name' is empty.
+func (l ServerList) Lookup(name string) (Server, bool) {
+	for _, s := range l {
+		if name == "" || s.Name == name {
+			return s, true
+		}
+	}
+	return Server{}, false
+}
+
+//SJob is a job, and the server it comes from.
+type SJob struct {
+	Server      string // the server name
+	Unreachable bool   // true if the server is down, the job is in its last known state.
+	*format.Job
+}
+
+//Key uniquely identifies the job among all servers.
+func (j SJob) Key() string { return j.Server + "/" + j.GetId().GetName() }
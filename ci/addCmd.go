@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -9,11 +10,20 @@ import (
 	"github.com/ericaro/ci/format"
 )
 
-type addCmd struct{}
+type addCmd struct {
+	labels  labelsFlag
+	env     varsFlag
+	secrets varsFlag
+}
 
-func (cmd *addCmd) Flags(fs *flag.FlagSet) *flag.FlagSet { return fs }
+func (cmd *addCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	fs.Var(&cmd.labels, "label", "job label as key=value (repeatable).")
+	fs.Var(&cmd.env, "env", "job variable as name=value (repeatable).")
+	fs.Var(&cmd.secrets, "secret", "job secret as name, valued from the environment, or name=value (repeatable).")
+	return fs
+}
 func (cmd *addCmd) Run(args []string) {
-	c := format.NewClient(*server)
+	c := client()
 	//ci add job remote branch
 	// TODO(ea) check arg count
 
@@ -23,23 +33,14 @@ func (cmd *addCmd) Run(args []string) {
 		os.Exit(-1)
 	}
 	job, remote, branch := args[0], args[1], args[2]
-	req := &format.Request{
-		Add: &format.AddRequest{
-			Id: &format.Jobid{
-				Name:   &job,
-				Remote: &remote,
-				Branch: &branch,
-			},
-		},
-	}
-
-	resp, err := c.Proto(req)
+	labels, err := format.LabelMap(cmd.labels)
 	if err != nil {
 		log.Fatal(err.Error())
 	}
-	if resp.Error != nil {
-		fmt.Printf("%s\n", *resp.Error)
-	} else {
-		fmt.Printf("added %s %s %s\n", job, remote, branch)
+
+	err = c.AddJob(context.Background(), job, remote, branch, labels, cmd.env, cmd.secrets)
+	if err != nil {
+		fatal(err)
 	}
+	fmt.Printf("added %s %s %s\n", job, remote, branch)
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/ericaro/ci/format"
+)
+
+type applyCmd struct {
+	file   *string
+	prune  *bool
+	dryrun *bool
+}
+
+func (cmd *applyCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.file = fs.String("f", "", "job file (yaml) describing all the jobs.")
+	cmd.prune = fs.Bool("prune", false, "remove jobs that are not in the job file.")
+	cmd.dryrun = fs.Bool("dry-run", false, "only print what would be changed.")
+	return fs
+}
+func (cmd *applyCmd) Run(args []string) {
+	c := client()
+
+	if len(args) != 0 || *cmd.file == "" {
+		fmt.Printf("apply command requires a -f <file> option, and no arguments.\n")
+		flag.Usage()
+		os.Exit(-1)
+	}
+
+	f, err := format.ReadJobFile(*cmd.file)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	a, err := c.ApplyJobs(context.Background(), f.Jobids(), *cmd.prune, *cmd.dryrun)
+	if err != nil {
+		fatal(err)
+	}
+	err = render(a, func() {
+		if a.Empty() {
+			fmt.Printf("jobs are up to date\n")
+			return
+		}
+		fmt.Print(a.Diff())
+	})
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/ericaro/ci/format"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the content of the client config file (see ConfigFile):
+//
+//	current: prod
+//	profiles:
+//	  prod:
+//	    url: https://ci.example.com:2020
+//	    token: s3cr3t
+//	    ca_cert: /etc/ssl/ci-ca.pem
+//	  local:
+//	    url: http://localhost:2020
+type Config struct {
+	Current  string              `yaml:"current,omitempty"`
+	Profiles map[string]*Profile `yaml:"profiles,omitempty"`
+}
+
+// Profile holds the settings to connect to a daemon.
+type Profile struct {
+	URL      string `yaml:"url"`
+	Token    string `yaml:"token,omitempty"`    // sent as a bearer token
+	CACert   string `yaml:"ca_cert,omitempty"`  // PEM file of the CA that signed the daemon certificate
+	Cert     string `yaml:"cert,omitempty"`     // PEM file of the client certificate, for mutual TLS
+	Key      string `yaml:"key,omitempty"`      // PEM file of the client key, with Cert
+	Insecure bool   `yaml:"insecure,omitempty"` // true to skip the daemon certificate verification
+}
+
+// ConfigFile returns the path of the client config file: $XDG_CONFIG_HOME/ci/config,
+// or ~/.config/ci/config.
+func ConfigFile() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = "."
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "ci", "config")
+}
+
+// ReadConfig reads the config file, it returns an empty config if there is none.
+func ReadConfig() (*Config, error) {
+	filename := ConfigFile()
+	c := &Config{Profiles: make(map[string]*Profile)}
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %s", filename, err.Error())
+	}
+	if c.Profiles == nil {
+		c.Profiles = make(map[string]*Profile)
+	}
+	return c, nil
+}
+
+// Write writes the config file, readable by the user only: it contains tokens.
+func (c *Config) Write() error {
+	filename := ConfigFile()
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, b, 0600)
+}
+
+// Client creates a client for the profile.
+func (p *Profile) Client() (*format.Client, error) {
+	c := format.NewClient(p.URL)
+	c.Token = p.Token
+	if p.CACert == "" && p.Cert == "" && !p.Insecure {
+		return c, nil
+	}
+
+	config := &tls.Config{InsecureSkipVerify: p.Insecure}
+	if p.CACert != "" {
+		pem, err := ioutil.ReadFile(p.CACert)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", p.CACert)
+		}
+	}
+	if p.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(p.Cert, p.Key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	c.Client = &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: config,
+	}}
+	return c, nil
+}
+
+// CurrentProfile returns the profile selected by the command line.
+//
+// The profile is the one named by -profile, or the config current one. Its url
+// is overridden by -s, or else by $CI_SERVER. Without config, the url is DefaultCIServer.
+func CurrentProfile() (*Profile, error) {
+	c, err := ReadConfig()
+	if err != nil {
+		return nil, err
+	}
+	name := *profile
+	if name == "" {
+		name = c.Current
+	}
+	p := &Profile{URL: DefaultCIServer}
+	if name != "" {
+		found, exists := c.Profiles[name]
+		if !exists {
+			return nil, fmt.Errorf("no such profile %q in %s", name, ConfigFile())
+		}
+		cp := *found
+		p = &cp
+	}
+
+	explicit := false
+	flag.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "s" })
+	switch {
+	case explicit:
+		p.URL = *server
+	case os.Getenv("CI_SERVER") != "":
+		p.URL = os.Getenv("CI_SERVER")
+	}
+	return p, nil
+}
+
+// client returns the client for the current profile, or exits.
+func client() *format.Client {
+	p, err := CurrentProfile()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	c, err := p.Client()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	return c
+}
+
+//fatal prints 'err' and exits: errors reported by the daemon, or about its
+// features, are printed as is, others (network, http) are logged.
+func fatal(err error) {
+	switch err.(type) {
+	case *format.ServerError, *format.UnsupportedError:
+		fmt.Println(err.Error())
+		os.Exit(-1)
+	}
+	log.Fatal(err.Error())
+}
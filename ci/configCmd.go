@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"text/tabwriter"
+)
+
+const configUsage = `config command requires a sub command:
+
+    - list                       : lists profiles, the current one is marked with '*'
+    - set <name> -url <url> [...]: creates or updates a profile
+    - use <name>                 : makes a profile the current one
+    - remove <name>              : removes a profile
+`
+
+type configCmd struct{}
+
+func (cmd *configCmd) Flags(fs *flag.FlagSet) *flag.FlagSet { return fs }
+func (cmd *configCmd) Run(args []string) {
+	if len(args) == 0 {
+		fmt.Print(configUsage)
+		os.Exit(-1)
+	}
+	c, err := ReadConfig()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	switch sub, args := args[0], args[1:]; {
+	case sub == "list" && len(args) == 0:
+		names := make([]string, 0, len(c.Profiles))
+		for name := range c.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", "", "Name", "URL", "Token", "TLS")
+		for _, name := range names {
+			p := c.Profiles[name]
+			current := ""
+			if name == c.Current {
+				current = "*"
+			}
+			token := "" // never print tokens
+			if p.Token != "" {
+				token = "yes"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", current, name, p.URL, token, tlsSummary(p))
+		}
+		w.Flush()
+		return
+
+	case sub == "set" && len(args) > 0:
+		name := args[0]
+		p, exists := c.Profiles[name]
+		if !exists {
+			p = new(Profile)
+		}
+		fs := flag.NewFlagSet("config set", flag.ExitOnError)
+		fs.StringVar(&p.URL, "url", p.URL, "daemon url.")
+		fs.StringVar(&p.Token, "token", p.Token, "token sent to the daemon.")
+		fs.StringVar(&p.CACert, "ca-cert", p.CACert, "PEM file of the CA that signed the daemon certificate.")
+		fs.StringVar(&p.Cert, "cert", p.Cert, "PEM file of the client certificate, for mutual TLS.")
+		fs.StringVar(&p.Key, "key", p.Key, "PEM file of the client key.")
+		fs.BoolVar(&p.Insecure, "insecure", p.Insecure, "skip the daemon certificate verification.")
+		fs.Parse(args[1:])
+		if p.URL == "" {
+			log.Fatalf("profile %q requires a -url", name)
+		}
+		c.Profiles[name] = p
+		if c.Current == "" {
+			c.Current = name
+		}
+
+	case sub == "use" && len(args) == 1:
+		if _, exists := c.Profiles[args[0]]; !exists {
+			log.Fatalf("no such profile %q", args[0])
+		}
+		c.Current = args[0]
+
+	case sub == "remove" && len(args) == 1:
+		if _, exists := c.Profiles[args[0]]; !exists {
+			log.Fatalf("no such profile %q", args[0])
+		}
+		delete(c.Profiles, args[0])
+		if c.Current == args[0] {
+			c.Current = ""
+		}
+
+	default:
+		fmt.Print(configUsage)
+		os.Exit(-1)
+	}
+
+	if err := c.Write(); err != nil {
+		log.Fatal(err.Error())
+	}
+}
+
+// tlsSummary describes the TLS settings of a profile.
+func tlsSummary(p *Profile) string {
+	switch {
+	case p.Insecure:
+		return "insecure"
+	case p.Cert != "":
+		return "mutual"
+	case p.CACert != "":
+		return "ca " + p.CACert
+	}
+	return ""
+}
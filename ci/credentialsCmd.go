@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ericaro/ci/format"
+	"github.com/golang/protobuf/proto"
+)
+
+const credentialsUsage = `credentials command requires a sub command:
+
+    - list                          : lists the git credentials, without their secret
+    - add <name> (-host <host> | -job <name>) (-ssh-key <file> | -token <file>) [-user <name>]
+                                    : creates credentials, for a host, or a job's remote
+                                      ('-' reads the key, or token from stdin)
+    - remove <name>                 : removes credentials
+`
+
+type credentialsCmd struct{}
+
+func (cmd *credentialsCmd) Flags(fs *flag.FlagSet) *flag.FlagSet { return fs }
+func (cmd *credentialsCmd) Run(args []string) {
+	c := client()
+	ctx := context.Background()
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	switch sub, args := args[0], args[1:]; {
+	case sub == "list" && len(args) == 0:
+		creds, err := c.Credentials(ctx)
+		if err != nil {
+			fatal(err)
+		}
+		err = render(creds, func() {
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", "Name", "Kind", "For", "User")
+			for _, cred := range creds {
+				target := cred.GetHost()
+				if cred.GetJobname() != "" {
+					target = "job " + cred.GetJobname()
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", cred.GetName(), cred.GetKind().Label(), target, cred.GetUsername())
+			}
+			w.Flush()
+		})
+		if err != nil {
+			fatal(err)
+		}
+
+	case sub == "add" && len(args) >= 1:
+		cred := &format.Credential{Name: proto.String(args[0])}
+		fs := flag.NewFlagSet("credentials add", flag.ExitOnError)
+		host := fs.String("host", "", "use the credentials for all the remotes on this host, e.g. github.com.")
+		job := fs.String("job", "", "use the credentials for this job's remote only.")
+		key := fs.String("ssh-key", "", "file containing a private ssh key, e.g. a deploy key.")
+		token := fs.String("token", "", "file containing an https token.")
+		user := fs.String("user", "", "https username of the token (default git).")
+		fs.Parse(args[1:])
+		if *host != "" {
+			cred.Host = host
+		}
+		if *job != "" {
+			cred.Jobname = job
+		}
+		if *user != "" {
+			cred.Username = user
+		}
+		var file string
+		switch {
+		case *key != "" && *token == "":
+			cred.Kind, file = format.CredentialKind_SSH_KEY.Enum(), *key
+		case *token != "" && *key == "":
+			cred.Kind, file = format.CredentialKind_HTTPS_TOKEN.Enum(), *token
+		default:
+			fmt.Print(credentialsUsage)
+			os.Exit(-1)
+		}
+		// secrets are read from files, never from the command line, that anyone can see.
+		var secret []byte
+		var err error
+		if file == "-" {
+			secret, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			secret, err = ioutil.ReadFile(file)
+		}
+		if err != nil {
+			fmt.Printf("cannot read %s: %v\n", file, err)
+			os.Exit(-1)
+		}
+		cred.Secret = proto.String(string(secret))
+		if err := c.AddCredential(ctx, cred); err != nil {
+			fatal(err)
+		}
+		fmt.Printf("Added credentials %s\n", cred.GetName())
+
+	case sub == "remove" && len(args) == 1:
+		if err := c.RemoveCredential(ctx, args[0]); err != nil {
+			fatal(err)
+		}
+		fmt.Printf("Removed credentials %s\n", args[0])
+
+	default:
+		fmt.Print(credentialsUsage)
+		os.Exit(-1)
+	}
+}
@@ -17,8 +17,18 @@ DESCRIPTION:
 
     - add <name> <remote> <branch>: adds a job on the ci-daemon
     - remove <name>               : removes a job
-    - list                        : lists jobs on the server
+    - list [-l key=value]         : lists jobs on the server
     - log <name>                  : logs details about a job
+    - apply -f <file>             : reconciles jobs with a job file
+    - export                      : dumps all jobs as a job file
+    - import -f <file>            : loads jobs from a job file
+    - wait <name>                 : waits until a job is built, exits 0 on success
+    - events [<name>]             : prints the job events (scheduled, refreshed, built, added, ...)
+    - hooks <list|add|remove|deliveries|redeliver>: manages the outgoing webhooks
+    - top                         : displays all jobs, live, with their logs and actions
+    - local <name> [<remote> <branch>]: runs a job on this machine, without a daemon
+    - config <list|set|use|remove>: manages the daemon profiles, in ~/.config/ci/config
+    - version                     : prints the client, and daemon versions, and the daemon features
 
 OPTIONS:
 
@@ -30,10 +40,70 @@ To add a repo to be built:
 
   %[1]s add mrepo git@github.com:ericaro/mrepo.git master
 
+To label it, and list only the jobs of a team:
+
+  %[1]s add -label team=infra -label lang=go mrepo git@github.com:ericaro/mrepo.git master
+  %[1]s list -l team=infra
+
+To give a job variables, and secrets (the value of NPM_TOKEN is read from your
+environment, it is encrypted in the daemon db, never returned, and redacted
+from the job outputs):
+
+  %[1]s add -env GOFLAGS=-mod=vendor -secret NPM_TOKEN web git@github.com:ericaro/web.git master
+
 To check a build progress:
 
   %[1]s log mrepo
 
+To wait for the build of a push, given the version listed before the push:
+
+  git push
+  %[1]s wait -version <previous version> -timeout 20m mrepo
+
+To follow what the daemon does, or the builds of a job:
+
+  %[1]s events -f
+  %[1]s events -n 50 mrepo
+
+To post build results to a chat, signed with a secret, and check the deliveries:
+
+  %[1]s hooks add chat https://chat.example.com/hooks/ci -secret s3cr3t
+  %[1]s hooks add deploy https://deploy.example.com/ci -job mrepo -event build_started -event build_finished
+  %[1]s hooks deliveries -failed
+  %[1]s hooks redeliver 42
+
+To refresh private remotes, with a deploy key for a job, or a token for a host
+(the daemon stores them encrypted, and never returns, nor logs them):
+
+  %[1]s credentials add web-deploy -job web -ssh-key ~/.ssh/web_deploy
+  echo $GITHUB_TOKEN | %[1]s credentials add github -host github.com -token -
+  %[1]s credentials list
+
+To get machine readable outputs (list, log, wait, events, hooks, credentials, apply and import):
+
+  %[1]s -o json list
+  %[1]s -o 'template={{range .}}{{.Id.GetName}} {{.State}}{{"\n"}}{{end}}' list
+
+To reproduce a CI failure on your machine (the job definition is read from the daemon):
+
+  %[1]s local -d /tmp/mrepo mrepo
+
+To work with several daemons:
+
+  %[1]s config set prod -url https://ci.example.com:2020 -token s3cr3t -ca-cert ca.pem
+  %[1]s config set local -url http://localhost:2020
+  %[1]s config use local
+  %[1]s -profile prod list
+
+To declare all jobs in a file:
+
+  %[1]s apply -f jobs.yaml -prune
+
+To move all jobs, and their history, to another daemon:
+
+  %[1]s export -history > jobs.yaml
+  %[1]s -s http://other:2020 import -f jobs.yaml
+
 `
 )
 
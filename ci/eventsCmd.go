@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ericaro/ci/format"
+	"github.com/golang/protobuf/proto"
+)
+
+type eventsCmd struct {
+	limit  *int
+	follow *bool
+}
+
+func (cmd *eventsCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.limit = fs.Int("n", 20, "number of past events to print.")
+	cmd.follow = fs.Bool("f", false, "keep printing the next events.")
+	return fs
+}
+func (cmd *eventsCmd) Run(args []string) {
+	c := client()
+
+	if len(args) > 1 {
+		fmt.Printf("events command requires 0 or 1 arguments. Got %v\n", len(args))
+		flag.Usage()
+		os.Exit(-1)
+	}
+	q := &format.EventsRequest{Limit: proto.Int32(int32(*cmd.limit))}
+	if len(args) == 1 {
+		q.Jobname = &args[0]
+	}
+
+	for {
+		events, err := c.Events(context.Background(), q)
+		if err != nil {
+			fatal(err)
+		}
+		err = render(events, func() {
+			for _, e := range events {
+				printEvent(e)
+			}
+		})
+		if err != nil {
+			fatal(err)
+		}
+		if !*cmd.follow {
+			return
+		}
+		if n := len(events); n > 0 {
+			q.Since = proto.Int64(events[n-1].GetId())
+		}
+		q.Limit = nil // while following, print them all
+		q.Timeout = proto.Int64(int64(longPoll / time.Second))
+	}
+}
+
+//printEvent writes 'e' as a single line.
+func printEvent(e *format.Event) {
+	t := e.GetType()
+	label := t.Label()
+	if t == format.EventType_REFRESH_FINISHED || t == format.EventType_BUILD_FINISHED {
+		if e.GetErrcode() == 0 {
+			label = color("00;32", label)
+		} else {
+			label = color("00;31", fmt.Sprintf("%s (errcode %d)", label, e.GetErrcode()))
+		}
+	}
+	line := fmt.Sprintf("%s %-20s %s", time.Unix(e.GetTime(), 0).Format("2006-01-02 15:04:05"), e.GetJobname(), label)
+	if v := e.GetVersion(); v != "" {
+		line += " " + v[:8]
+	}
+	if d := e.GetDetail(); d != "" {
+		line += ": " + d
+	}
+	fmt.Println(line)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/ericaro/ci/format"
+	"gopkg.in/yaml.v2"
+)
+
+type exportCmd struct {
+	history *bool
+	format  *string
+}
+
+func (cmd *exportCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.history = fs.Bool("history", false, "also export each job's last refresh and build, and its build history.")
+	cmd.format = fs.String("format", "yaml", "output format: yaml or json.")
+	return fs
+}
+func (cmd *exportCmd) Run(args []string) {
+	c := client()
+
+	if len(args) != 0 {
+		fmt.Printf("export command requires no arguments. Got %v\n", len(args))
+		flag.Usage()
+		os.Exit(-1)
+	}
+
+	jobs, err := c.ExportJobs(context.Background(), *cmd.history)
+	if err != nil {
+		fatal(err)
+	}
+	f := format.NewJobFile(jobs)
+
+	var b []byte
+	switch *cmd.format {
+	case "yaml":
+		b, err = yaml.Marshal(f)
+	case "json":
+		b, err = json.MarshalIndent(f, "", "  ")
+		b = append(b, '\n')
+	default:
+		err = fmt.Errorf("unknown format %q", *cmd.format)
+	}
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	os.Stdout.Write(b)
+}
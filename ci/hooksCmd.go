@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ericaro/ci/format"
+	"github.com/golang/protobuf/proto"
+)
+
+const hooksUsage = `hooks command requires a sub command:
+
+    - list                          : lists the outgoing webhooks
+    - add <name> <url> [-job <name>] [-event <type>...] [-secret <secret>]
+                                    : creates a webhook, for all jobs, or a single one
+    - remove <name>                 : removes a webhook
+    - deliveries [-hook <name>] [-failed] [-n 20]
+                                    : lists the last deliveries
+    - redeliver <id>                : sends a delivery again
+`
+
+//eventsFlag is a repeatable -event flag, it accepts event type names in any case.
+type eventsFlag []format.EventType
+
+func (f *eventsFlag) String() string { return fmt.Sprintf("%v", *f) }
+func (f *eventsFlag) Set(value string) error {
+	name := strings.ToUpper(strings.NewReplacer("-", "_", " ", "_").Replace(value))
+	t, exists := format.EventType_value[name]
+	if !exists {
+		return fmt.Errorf("unknown event type %q", value)
+	}
+	*f = append(*f, format.EventType(t))
+	return nil
+}
+
+type hooksCmd struct{}
+
+func (cmd *hooksCmd) Flags(fs *flag.FlagSet) *flag.FlagSet { return fs }
+func (cmd *hooksCmd) Run(args []string) {
+	c := client()
+	ctx := context.Background()
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	switch sub, args := args[0], args[1:]; {
+	case sub == "list" && len(args) == 0:
+		resp, err := c.Hooks(ctx, &format.HooksRequest{Limit: proto.Int32(1)})
+		if err != nil {
+			fatal(err)
+		}
+		hooks := resp.GetHooks()
+		err = render(hooks, func() {
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", "Name", "URL", "Job", "Events", "Signed")
+			for _, h := range hooks {
+				job := h.GetJobname()
+				if job == "" {
+					job = "*"
+				}
+				events := h.GetEvents()
+				if len(events) == 0 {
+					events = format.DefaultHookEvents
+				}
+				labels := make([]string, 0, len(events))
+				for _, t := range events {
+					labels = append(labels, t.Label())
+				}
+				signed := "" // never print secrets
+				if h.GetSigned() {
+					signed = "yes"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", h.GetName(), h.GetUrl(), job, strings.Join(labels, ", "), signed)
+			}
+			w.Flush()
+		})
+		if err != nil {
+			fatal(err)
+		}
+
+	case sub == "add" && len(args) >= 2:
+		h := &format.Hook{Name: proto.String(args[0]), Url: proto.String(args[1])}
+		var events eventsFlag
+		fs := flag.NewFlagSet("hooks add", flag.ExitOnError)
+		job := fs.String("job", "", "only deliver this job's events (default all jobs).")
+		fs.Var(&events, "event", "event type to deliver, e.g. build_finished (repeatable, default build_finished).")
+		secret := fs.String("secret", os.Getenv("CI_HOOK_SECRET"), "secret to sign the payloads with (default $CI_HOOK_SECRET).")
+		fs.Parse(args[2:])
+		if *job != "" {
+			h.Jobname = job
+		}
+		if *secret != "" {
+			h.Secret = secret
+		}
+		h.Events = events
+		if err := c.AddHook(ctx, h); err != nil {
+			fatal(err)
+		}
+		fmt.Printf("Added hook %s %s\n", h.GetName(), h.GetUrl())
+
+	case sub == "remove" && len(args) == 1:
+		if err := c.RemoveHook(ctx, args[0]); err != nil {
+			fatal(err)
+		}
+		fmt.Printf("Removed hook %s\n", args[0])
+
+	case sub == "deliveries":
+		q := new(format.HooksRequest)
+		fs := flag.NewFlagSet("hooks deliveries", flag.ExitOnError)
+		hook := fs.String("hook", "", "only the deliveries of this hook.")
+		failed := fs.Bool("failed", false, "only the failed deliveries.")
+		limit := fs.Int("n", 20, "number of deliveries to list.")
+		fs.Parse(args)
+		if *hook != "" {
+			q.Hook = hook
+		}
+		q.Failed, q.Limit = failed, proto.Int32(int32(*limit))
+		resp, err := c.Hooks(ctx, q)
+		if err != nil {
+			fatal(err)
+		}
+		deliveries := resp.GetDeliveries()
+		err = render(deliveries, func() {
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", "Id", "Hook", "Event", "Job", "State", "Attempts", "Last attempt")
+			for _, d := range deliveries {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%s\n", d.GetId(), d.GetHook(), d.GetEvent().GetType().Label(), d.GetEvent().GetJobname(), deliveryState(d), d.GetAttempts(), lastAttempt(d))
+			}
+			w.Flush()
+		})
+		if err != nil {
+			fatal(err)
+		}
+
+	case sub == "redeliver" && len(args) == 1:
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			fmt.Printf("invalid delivery id %q\n", args[0])
+			os.Exit(-1)
+		}
+		d, err := c.Redeliver(ctx, id)
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Printf("Redelivering %d as %d\n", id, d.GetId())
+
+	default:
+		fmt.Print(hooksUsage)
+		os.Exit(-1)
+	}
+}
+
+//deliveryState describes a delivery state, with its last error.
+func deliveryState(d *format.Delivery) string {
+	s := d.GetState().Label()
+	switch d.GetState() {
+	case format.DeliveryState_DELIVERY_SUCCEEDED:
+		return color("00;32", s)
+	case format.DeliveryState_DELIVERY_FAILED:
+		return color("00;31", s+": "+d.GetError())
+	}
+	if d.GetError() != "" { // waiting for a retry
+		return s + " (" + d.GetError() + ")"
+	}
+	return s
+}
+
+//lastAttempt formats the time of the last attempt, if any.
+func lastAttempt(d *format.Delivery) string {
+	if d.GetTime() == 0 {
+		return ""
+	}
+	return time.Unix(d.GetTime(), 0).Format("2006-01-02 15:04:05")
+}
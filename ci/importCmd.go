@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/ericaro/ci/format"
+)
+
+type importCmd struct {
+	file      *string
+	overwrite *bool
+}
+
+func (cmd *importCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.file = fs.String("f", "", "job file (yaml or json) as produced by export.")
+	cmd.overwrite = fs.Bool("overwrite", false, "replace jobs that already exist, instead of skipping them.")
+	return fs
+}
+func (cmd *importCmd) Run(args []string) {
+	c := client()
+
+	if len(args) != 0 || *cmd.file == "" {
+		fmt.Printf("import command requires a -f <file> option, and no arguments.\n")
+		flag.Usage()
+		os.Exit(-1)
+	}
+
+	f, err := format.ReadJobFile(*cmd.file)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	i, err := c.ImportJobs(context.Background(), f.JobMessages(), *cmd.overwrite)
+	if err != nil {
+		fatal(err)
+	}
+	err = render(i, func() {
+		for _, n := range i.GetImported() {
+			fmt.Printf("imported %s\n", n)
+		}
+		for _, n := range i.GetSkipped() {
+			fmt.Printf("skipped %s (already exists)\n", n)
+		}
+	})
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
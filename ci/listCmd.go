@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -10,11 +11,16 @@ import (
 	"github.com/ericaro/ci/format"
 )
 
-type listCmd struct{}
+type listCmd struct {
+	selector labelsFlag
+}
 
-func (cmd *listCmd) Flags(fs *flag.FlagSet) *flag.FlagSet { return fs }
+func (cmd *listCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	fs.Var(&cmd.selector, "l", "only list jobs with this label, as key=value (repeatable).")
+	return fs
+}
 func (cmd *listCmd) Run(args []string) {
-	c := format.NewClient(*server)
+	c := client()
 
 	if len(args) != 0 {
 		fmt.Printf("list command requires no arguments. Got %v\n", len(args))
@@ -22,42 +28,28 @@ func (cmd *listCmd) Run(args []string) {
 		os.Exit(-1)
 	}
 
-	req := &format.Request{
-		List: &format.ListRequest{}, // no options available in the command line, yet
+	// machine readable outputs are complete
+	jobs, err := c.ListJobs(context.Background(), false, false, !tableOutput(), cmd.selector)
+	if err != nil {
+		fatal(err)
 	}
+	if jobs == nil {
+		jobs = []*format.Job{}
+	}
+	err = render(jobs, func() {
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", "Status", "Name", "Remote", "Branch", "Version", "Labels")
+		for _, s := range jobs {
+			id := s.Id
+			refresh := s.Refresh
+			status := s.State().Label()
 
-	resp, err := c.Proto(req)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", status, id.GetName(), id.GetRemote(), id.GetBranch(), refresh.GetVersion(), format.LabelString(id.GetLabels()))
+		}
+		w.Flush()
+	})
 	if err != nil {
 		log.Fatal(err.Error())
 	}
-	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
-
-	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", "Status", "Name", "Remote", "Branch", "Version")
-	for _, s := range resp.List.Jobs {
-		id := s.Id
-		refresh := s.Refresh
-		build := s.Build
-		refreshFailed := refresh.GetErrcode() != 0
-		buildFailed := build.GetErrcode() != 0
-
-		uptodate := refresh.GetVersion() == build.GetVersion()
-		var status string
-		switch {
-		case refresh.GetEnd() < refresh.GetStart():
-			status = "Pulling"
-		case build.GetEnd() < build.GetStart():
-			status = "Building"
-		case !uptodate:
-			status = "Need Build"
-		case refreshFailed:
-			status = "Pulling Failed"
-		case buildFailed:
-			status = "Building Failed"
-		default:
-			status = "Success"
-		}
-
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", status, id.GetName(), id.GetRemote(), id.GetBranch(), refresh.GetVersion())
-	}
-	w.Flush()
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/ericaro/ci"
+	"github.com/ericaro/ci/format"
+)
+
+type localCmd struct {
+	dir *string
+}
+
+func (cmd *localCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.dir = fs.String("d", "", "directory where the job is checked out (a temporary one by default).")
+	return fs
+}
+
+func (cmd *localCmd) Run(args []string) {
+	var name, remote, branch string
+	switch len(args) {
+	case 1: // read the job definition from the daemon
+		name = args[0]
+		id := cmd.GetJobid(name)
+		remote, branch = id.GetRemote(), id.GetBranch()
+	case 3:
+		name, remote, branch = args[0], args[1], args[2]
+	default:
+		fmt.Printf("local command requires 1 or 3 arguments. Got %v\n", len(args))
+		flag.Usage()
+		os.Exit(-1)
+	}
+
+	dir := *cmd.dir
+	if dir == "" {
+		tmp, err := ioutil.TempDir("", "ci-local-")
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		dir = tmp
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	fmt.Printf("running %s %s %s in %s\n", name, remote, branch, dir)
+
+	// ^C cancels the build: commands run in their own process group, they would not get it.
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	job := ci.RunJobNow(ctx, dir, name, remote, branch, os.Stdout)
+
+	fmt.Println()
+	fmt.Println(newExec(job.GetRefresh(), "refresh").Summary())
+	if job.GetBuild().GetStart() != 0 {
+		fmt.Println(newExec(job.GetBuild(), "build").Summary())
+	}
+	for _, s := range job.GetStages() {
+		fmt.Println("    ", newExec(s.GetExecution(), "stage "+s.GetName()).Summary())
+	}
+	os.Exit(exitCode(job))
+}
+
+//GetJobid reads the job definition from the daemon.
+func (cmd *localCmd) GetJobid(name string) *format.Jobid {
+	job, err := client().Job(context.Background(), name)
+	if err != nil {
+		fatal(err)
+	}
+	return job.GetId()
+}
+
+//exitCode returns the build exit code if any, 1 for any other failure, 0 on success.
+func exitCode(job *format.Job) int {
+	if job.State() == format.JobStatus_SUCCESS {
+		return 0
+	}
+	for _, x := range []*format.Execution{job.GetRefresh(), job.GetBuild()} {
+		if x.GetErrcode() > 0 {
+			return int(x.GetErrcode())
+		}
+	}
+	return 1
+}
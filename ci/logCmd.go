@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -10,10 +11,14 @@ import (
 	"time"
 
 	"github.com/ericaro/ci/format"
+	"github.com/golang/protobuf/proto"
 )
 
 type logCmd struct {
 	tail *bool
+
+	revision uint64 // of the last watch response, see Next
+	poll     bool   // true if the daemon does not support watch requests
 }
 
 func (cmd *logCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
@@ -28,29 +33,35 @@ func (cmd *logCmd) Run(args []string) {
 	}
 
 	jobname := args[0]
+	c := client()
 
-	req := &format.Request{
-		Log: &format.LogRequest{
-			Jobname: &jobname,
-		},
+	if !tableOutput() {
+		if *cmd.tail {
+			log.Fatal("-tail is only available with the table output")
+		}
+		if err := render(cmd.Fetch(c, jobname), nil); err != nil {
+			log.Fatal(err.Error())
+		}
+		return
 	}
-	b, r := cmd.GetJob(req)
 
-	fmt.Println(r.Print(), "\n")
+	b, r, stages := cmd.GetJob(c, jobname)
+
+	fmt.Print(r.Print(), "\n\n")
 
 	if r.Done() { // if refresh has finished, print the build
 		fmt.Println(r.Summary())
 
-		fmt.Println(b.Print(), "\n")
+		fmt.Print(b.Print(), "\n\n")
 		if b.Done() { // if build has finished, print a summary
 			fmt.Println(b.Summary())
 		}
 	}
 
 	if *cmd.tail {
-		for _ = range time.Tick(2 * time.Second) {
+		for {
 
-			newb, newr := cmd.GetJob(req)
+			newb, newr, _ := cmd.execs(cmd.Next(c, jobname))
 
 			fmt.Print(r.Tail(newr))
 			fmt.Print(b.Tail(newb))
@@ -62,20 +73,71 @@ func (cmd *logCmd) Run(args []string) {
 		} else {
 			fmt.Println("\n\n", b.Summary(), "\n", r.Summary())
 		}
+		for _, s := range stages {
+			fmt.Println("    ", s.Summary())
+		}
 	}
 }
 
-func (cmd *logCmd) GetJob(req *format.Request) (b, r *exec) {
-	c := format.NewClient(*server)
-	resp, err := c.Proto(req)
+//Fetch returns the job, with its outputs and history.
+func (cmd *logCmd) Fetch(c *format.Client, jobname string) *format.Job {
+	job, err := c.Job(context.Background(), jobname)
 	if err != nil {
-		log.Fatal(err.Error())
+		fatal(err)
+	}
+	return job
+}
+
+//Next waits for the next change of the job, and returns it.
+//
+// It uses watch requests, or polls the daemon if it does not support them.
+func (cmd *logCmd) Next(c *format.Client, jobname string) *format.Job {
+	for {
+		if cmd.poll {
+			time.Sleep(2 * time.Second)
+			return cmd.Fetch(c, jobname)
+		}
+		resp, err := c.WatchJobs(context.Background(), &format.WatchRequest{
+			Revision:      &cmd.revision,
+			Jobname:       &jobname,
+			Timeout:       proto.Int64(int64(longPoll / time.Second)),
+			RefreshResult: proto.Bool(true),
+			BuildResult:   proto.Bool(true),
+		})
+		if _, ok := err.(*format.UnsupportedError); ok {
+			cmd.poll = true
+			continue
+		}
+		if err != nil {
+			fatal(err)
+		}
+		cmd.revision = resp.GetRevision()
+		if len(resp.GetRemoved()) > 0 || resp.GetFull() && len(resp.GetJobs()) == 0 {
+			fatal(format.Errorf(format.ErrorCode_NOT_FOUND, "job %q has been removed.", jobname))
+		}
+		if len(resp.GetJobs()) > 0 {
+			return resp.GetJobs()[0]
+		}
 	}
-	job := resp.GetLog().GetJob()
+}
+
+func (cmd *logCmd) GetJob(c *format.Client, jobname string) (b, r *exec, stages []*exec) {
+	return cmd.execs(cmd.Fetch(c, jobname))
+}
+
+//execs presents the job executions.
+func (cmd *logCmd) execs(job *format.Job) (b, r *exec, stages []*exec) {
 	// now present the resp
 	//
 	r = newExec(job.GetRefresh(), "refresh")
 	b = newExec(job.GetBuild(), "build")
+	for _, s := range job.GetStages() {
+		name := "stage " + s.GetName()
+		if s.GetAllowFailure() {
+			name += " (allowed to fail)"
+		}
+		stages = append(stages, newExec(s.GetExecution(), name))
+	}
 	return
 }
 
@@ -117,13 +179,13 @@ func (x *exec) Print() string {
 		fmt.Fprintf(buf, "%s started %s ago.\n", x.name, x.since)
 
 	case x.x.GetErrcode() != 0:
-		fmt.Fprintf(buf, "%s \033[00;31mfailed\033[00m %s ago\n\n", x.name, x.since)
+		fmt.Fprintf(buf, "%s %s %s ago\n\n", x.name, color("00;31", "failed"), x.since)
 
 	default:
-		fmt.Fprintf(buf, "%s \033[00;32msuccess\033[00m %s ago\n\n", x.name, x.since)
+		fmt.Fprintf(buf, "%s %s %s ago\n\n", x.name, color("00;32", "success"), x.since)
 	}
 
-	txt := x.x.GetResult()
+	txt := plain(x.x.GetResult())
 	fmt.Fprintf(buf, "\n%s", strings.Replace(txt, "\n", "\n    ", -1))
 
 	return buf.String()
@@ -143,7 +205,7 @@ func (x *exec) Tail(n *exec) string {
 	// now we are in an interesting case:
 	txt := x.x.GetResult()
 	is := n.x.GetResult()
-	tail := strings.TrimPrefix(is, txt)
+	tail := plain(strings.TrimPrefix(is, txt))
 	tail = strings.Replace(tail, "\n", "\n    ", -1)
 
 	if !x.Done() && n.Done() { // the new has finished
@@ -155,8 +217,8 @@ func (x *exec) Tail(n *exec) string {
 // Summary returns a small summary of the execution (status, duration and time since ended)
 func (x *exec) Summary() string {
 	if x.x.GetErrcode() == 0 {
-		return fmt.Sprintf("%s \033[00;32msuccess\033[00m in %s, %s ago", x.name, x.duration, x.since)
+		return fmt.Sprintf("%s %s in %s, %s ago", x.name, color("00;32", "success"), x.duration, x.since)
 	} else {
-		return fmt.Sprintf("%s \033[00;31mfailed\033[00m in %s, %s ago", x.name, x.duration, x.since)
+		return fmt.Sprintf("%s %s in %s, %s ago", x.name, color("00;31", "failed"), x.duration, x.since)
 	}
 }
@@ -2,7 +2,11 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"os"
+	"strings"
 
+	"github.com/ericaro/ci/format"
 	"github.com/rakyll/command"
 )
 
@@ -11,9 +15,46 @@ var (
 	//go install -ldflags '-X main.DefaultCIServer http://yourip:2020'
 
 	DefaultCIServer = "http://localhost:2020"
-	server          = flag.String("s", DefaultCIServer, "remote server address")
+	server          = flag.String("s", DefaultCIServer, "remote server address (default $CI_SERVER, or the profile's one)")
+	profile         = flag.String("profile", "", "profile to use, from the config file (see the config command)")
+	output          = flag.String("o", OutputTable, "output format: table, json, yaml, or template=<go template>")
 )
 
+//labelsFlag is a flag.Value accepting several "-label key=value", or "-label k1=v1,k2=v2".
+type labelsFlag []*format.Label
+
+func (l *labelsFlag) String() string { return format.LabelString(*l) }
+func (l *labelsFlag) Set(v string) error {
+	labels, err := format.ParseLabels(v)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, labels...)
+	return nil
+}
+
+//varsFlag is a flag.Value accepting several "-env name=value". A name alone takes
+// its value from the environment, to keep secrets out of the command line.
+type varsFlag map[string]string
+
+func (m *varsFlag) String() string { return fmt.Sprintf("%v", len(*m)) }
+func (m *varsFlag) Set(v string) error {
+	if *m == nil {
+		*m = make(varsFlag)
+	}
+	i := strings.Index(v, "=")
+	if i < 0 {
+		value, exists := os.LookupEnv(v)
+		if !exists {
+			return fmt.Errorf("%s is not set in the environment", v)
+		}
+		(*m)[v] = value
+		return nil
+	}
+	(*m)[v[:i]] = v[i+1:]
+	return nil
+}
+
 func main() {
 	command.On("add",
 		"<name> <remote> <branch>: adds a job on the ci-daemon", &addCmd{}, nil)
@@ -23,6 +64,28 @@ func main() {
 		"                        : lists jobs on the server", &listCmd{}, nil)
 	command.On("log",
 		"<name>                  : logs details about a job", &logCmd{}, nil)
+	command.On("apply",
+		"-f <file>               : reconciles jobs with a job file", &applyCmd{}, nil)
+	command.On("export",
+		"                        : dumps all jobs as a job file", &exportCmd{}, nil)
+	command.On("import",
+		"-f <file>               : loads jobs from a job file", &importCmd{}, nil)
+	command.On("wait",
+		"<name>                  : waits until a job is built", &waitCmd{}, nil)
+	command.On("events",
+		"[<name>]                : prints the job events journal", &eventsCmd{}, nil)
+	command.On("hooks",
+		"<list|add|remove|deliveries|redeliver> ...: manages the outgoing webhooks", &hooksCmd{}, nil)
+	command.On("credentials",
+		"<list|add|remove> ...   : manages the git credentials of private remotes", &credentialsCmd{}, nil)
+	command.On("top",
+		"                        : displays all jobs, live", &topCmd{}, nil)
+	command.On("config",
+		"<list|set|use|remove> ...: manages the daemon profiles", &configCmd{}, nil)
+	command.On("version",
+		"                        : prints the client, and daemon versions, and the daemon features", &versionCmd{}, nil)
+	command.On("local",
+		"<name> [<remote> <branch>]: runs a job on this machine", &localCmd{}, nil)
 
 	command.ParseAndRun()
 
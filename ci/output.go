@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v2"
+)
+
+//output formats, see the -o option.
+const (
+	OutputTable    = "table"     // human friendly
+	OutputJSON     = "json"      // the format messages, with their json field names
+	OutputYAML     = "yaml"      // same as json
+	OutputTemplate = "template=" // prefix of a text/template executed on the format messages
+)
+
+//colors is true when ANSI colors can be written to stdout.
+var colors = os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+
+//isTerminal returns true if 'f' is a terminal (and not a pipe, or a file).
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+//color wraps 's' in the ANSI color 'code' ("00;31" is red), if colors are enabled.
+func color(code, s string) string {
+	if !colors {
+		return s
+	}
+	return "\033[" + code + "m" + s + "\033[00m"
+}
+
+//ansiEscape matches ANSI escape sequences, as written by build tools.
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*[A-Za-z]")
+
+//plain removes ANSI escape sequences from 's', if colors are disabled.
+func plain(s string) string {
+	if colors {
+		return s
+	}
+	return ansiEscape.ReplaceAllString(s, "")
+}
+
+//tableOutput returns true if the -o option asks for the human friendly output.
+func tableOutput() bool { return *output == OutputTable }
+
+//render writes 'v', a format message or a slice of them, to stdout in the -o format.
+//
+// 'table' writes the human friendly version.
+func render(v interface{}, table func()) error {
+	switch {
+	case *output == OutputTable:
+		table()
+		return nil
+	case *output == OutputJSON:
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(append(b, '\n'))
+		return nil
+	case *output == OutputYAML:
+		// go through json, to get the same field names.
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		// MapSlice keeps the json field order
+		var obj yaml.MapSlice
+		var list []yaml.MapSlice
+		if strings.HasPrefix(string(b), "[") {
+			err = yaml.Unmarshal(b, &list)
+			b, _ = yaml.Marshal(list)
+		} else {
+			err = yaml.Unmarshal(b, &obj)
+			b, _ = yaml.Marshal(obj)
+		}
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(b)
+		return nil
+	case strings.HasPrefix(*output, OutputTemplate):
+		t, err := template.New("o").Parse(strings.TrimPrefix(*output, OutputTemplate))
+		if err != nil {
+			return err
+		}
+		return t.Execute(os.Stdout, v)
+	default:
+		return fmt.Errorf("unknown output %q, expecting table, json, yaml, or template=...", *output)
+	}
+}
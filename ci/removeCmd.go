@@ -1,19 +1,17 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"log"
 	"os"
-
-	"github.com/ericaro/ci/format"
 )
 
 type removeCmd struct{}
 
 func (cmd *removeCmd) Flags(fs *flag.FlagSet) *flag.FlagSet { return fs }
 func (cmd *removeCmd) Run(args []string) {
-	c := format.NewClient(*server)
+	c := client()
 
 	//ci add job remote branch
 	// TODO(ea) check arg count
@@ -24,20 +22,9 @@ func (cmd *removeCmd) Run(args []string) {
 	}
 
 	job := args[0]
-	req := &format.Request{
-		Remove: &format.RemoveRequest{
-			Jobname: &job,
-		},
-	}
-
-	resp, err := c.Proto(req)
+	err := c.RemoveJob(context.Background(), job)
 	if err != nil {
-		log.Fatal(err.Error())
+		fatal(err)
 	}
-	if resp.Error != nil {
-		fmt.Printf("%s\n", *resp.Error)
-	} else {
-		fmt.Printf("removed %s\n", job)
-	}
-
+	fmt.Printf("removed %s\n", job)
 }
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ericaro/ci/format"
+	"github.com/nsf/termbox-go"
+)
+
+type topCmd struct {
+	period   *time.Duration
+	selector labelsFlag
+
+	c        *format.Client
+	jobs     []*format.Job // sorted by name
+	selected int           // index in jobs
+	job      *format.Job   // the job whose log is displayed, nil in the list view
+	scroll   int           // first log line displayed, -1 to follow the end
+	message  string        // result of the last action, or error
+}
+
+func (cmd *topCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.period = fs.Duration("period", time.Second, "period between two refreshes.")
+	fs.Var(&cmd.selector, "l", "only display jobs with this label, as key=value (repeatable).")
+	return fs
+}
+
+func (cmd *topCmd) Run(args []string) {
+	cmd.c = client()
+
+	if len(args) != 0 {
+		fmt.Printf("top command requires no arguments. Got %v\n", len(args))
+		flag.Usage()
+		os.Exit(-1)
+	}
+	if err := termbox.Init(); err != nil {
+		log.Fatal(err.Error())
+	}
+	defer termbox.Close()
+
+	events := make(chan termbox.Event)
+	go func() {
+		for {
+			events <- termbox.PollEvent()
+		}
+	}()
+	tick := time.NewTicker(*cmd.period)
+	defer tick.Stop()
+
+	cmd.fetch()
+	cmd.draw()
+	for {
+		select {
+		case <-tick.C:
+			cmd.fetch()
+		case e := <-events:
+			if e.Type == termbox.EventKey && !cmd.key(e) {
+				return
+			}
+		}
+		cmd.draw()
+	}
+}
+
+//key handles a key press, it returns false to quit.
+func (cmd *topCmd) key(e termbox.Event) bool {
+	switch {
+	case e.Key == termbox.KeyCtrlC:
+		return false
+	case e.Ch == 'q' || e.Key == termbox.KeyEsc:
+		if cmd.job == nil {
+			return false
+		}
+		cmd.job = nil // back to the list
+	case e.Key == termbox.KeyEnter && cmd.job == nil && len(cmd.jobs) > 0:
+		cmd.job = cmd.jobs[cmd.selected]
+		cmd.scroll = -1
+		cmd.fetch()
+	case e.Key == termbox.KeyArrowUp || e.Ch == 'k':
+		if cmd.job != nil {
+			cmd.scrollBy(-1)
+		} else if cmd.selected > 0 {
+			cmd.selected--
+		}
+	case e.Key == termbox.KeyArrowDown || e.Ch == 'j':
+		if cmd.job != nil {
+			cmd.scrollBy(1)
+		} else if cmd.selected < len(cmd.jobs)-1 {
+			cmd.selected++
+		}
+	case e.Key == termbox.KeyPgup:
+		cmd.scrollBy(-cmd.logHeight())
+	case e.Key == termbox.KeyPgdn:
+		cmd.scrollBy(cmd.logHeight())
+	case e.Key == termbox.KeyEnd || e.Ch == 'G':
+		cmd.scroll = -1
+	case e.Ch == 'r':
+		cmd.act("rebuild", func(name string) error { return cmd.c.BuildJob(context.Background(), name, false) })
+	case e.Ch == 'f':
+		cmd.act("force rebuild", func(name string) error { return cmd.c.BuildJob(context.Background(), name, true) })
+	case e.Ch == 'c':
+		cmd.act("cancel", func(name string) error { return cmd.c.CancelJob(context.Background(), name) })
+	}
+	return true
+}
+
+//current returns the name of the job under the cursor, or whose log is displayed.
+func (cmd *topCmd) current() string {
+	if cmd.job != nil {
+		return cmd.job.GetId().GetName()
+	}
+	if len(cmd.jobs) == 0 {
+		return ""
+	}
+	return cmd.jobs[cmd.selected].GetId().GetName()
+}
+
+//act runs an action on the current job, and displays its result.
+func (cmd *topCmd) act(action string, do func(name string) error) {
+	name := cmd.current()
+	if name == "" {
+		return
+	}
+	if err := do(name); err != nil {
+		cmd.message = err.Error()
+	} else {
+		cmd.message = fmt.Sprintf("%s %s: ok", action, name)
+	}
+	cmd.fetch()
+}
+
+//fetch refreshes the job list, and the displayed job.
+func (cmd *topCmd) fetch() {
+	jobs, err := cmd.c.ListJobs(context.Background(), false, false, true, cmd.selector)
+	if err != nil {
+		cmd.message = err.Error()
+		return
+	}
+	cmd.jobs = jobs
+	sort.Sort(jobsByName(cmd.jobs))
+	if cmd.selected >= len(cmd.jobs) {
+		cmd.selected = len(cmd.jobs) - 1
+	}
+	if cmd.selected < 0 {
+		cmd.selected = 0
+	}
+
+	if cmd.job == nil {
+		return
+	}
+	j, err := cmd.c.Job(context.Background(), cmd.job.GetId().GetName())
+	if err != nil {
+		cmd.message = err.Error()
+		return
+	}
+	cmd.job = j
+}
+
+//draw renders the current view.
+func (cmd *topCmd) draw() {
+	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+	w, h := termbox.Size()
+	if cmd.job == nil {
+		cmd.drawList(w, h)
+	} else {
+		cmd.drawLog(w, h)
+	}
+	text(0, h-1, termbox.ColorDefault, termbox.ColorDefault, cmd.message)
+	termbox.Flush()
+}
+
+func (cmd *topCmd) drawList(w, h int) {
+	header := fmt.Sprintf("%-12s %-30s %-10s %-10s %s", "STATUS", "NAME", "VERSION", "DURATION", "PROGRESS")
+	text(0, 0, termbox.AttrReverse, termbox.AttrReverse, pad(header, w))
+	for i, j := range cmd.jobs {
+		y := i + 1
+		if y >= h-2 {
+			break
+		}
+		s := j.State()
+		fg, bg := termbox.ColorDefault, termbox.ColorDefault
+		if i == cmd.selected {
+			fg, bg = termbox.AttrReverse, termbox.AttrReverse
+		}
+		line := fmt.Sprintf("%-12s %-30s %-10s %-10s %s", s.Label(), j.GetId().GetName(), short(j.GetRefresh().GetVersion()), duration(j), progress(j))
+		text(0, y, fg, bg, pad(line, w))
+		text(0, y, statusColor(s)|fg, bg, s.Label())
+	}
+	text(0, h-2, termbox.ColorDefault, termbox.ColorDefault, "enter: log  r: rebuild  f: force rebuild  c: cancel  q: quit")
+}
+
+func (cmd *topCmd) drawLog(w, h int) {
+	j := cmd.job
+	s := j.State()
+	header := fmt.Sprintf("%s %s %s %s", j.GetId().GetName(), j.GetId().GetRemote(), j.GetId().GetBranch(), short(j.GetRefresh().GetVersion()))
+	text(0, 0, termbox.AttrReverse, termbox.AttrReverse, pad(header, w))
+	text(len(header)+1, 0, statusColor(s)|termbox.AttrReverse, termbox.AttrReverse, s.Label())
+
+	lines := cmd.logLines()
+	first := cmd.scroll
+	if first < 0 || first > len(lines)-cmd.logHeight() { // follow the end
+		first = len(lines) - cmd.logHeight()
+	}
+	if first < 0 {
+		first = 0
+	}
+	for i := 0; i < cmd.logHeight() && first+i < len(lines); i++ {
+		text(0, i+1, termbox.ColorDefault, termbox.ColorDefault, lines[first+i])
+	}
+	text(0, h-2, termbox.ColorDefault, termbox.ColorDefault, "up/down/pgup/pgdn: scroll  end: follow  r: rebuild  f: force rebuild  c: cancel  q: back")
+}
+
+//logLines returns the displayed job outputs, as lines.
+func (cmd *topCmd) logLines() []string {
+	txt := "--- refresh\n" + cmd.job.GetRefresh().GetResult()
+	if cmd.job.GetBuild().GetStart() != 0 {
+		txt += "\n--- build\n" + cmd.job.GetBuild().GetResult()
+	}
+	txt = ansiEscape.ReplaceAllString(txt, "") // termbox cannot render them
+	return strings.Split(strings.Replace(txt, "\t", "    ", -1), "\n")
+}
+
+//logHeight is the number of log lines on screen.
+func (cmd *topCmd) logHeight() int {
+	_, h := termbox.Size()
+	return h - 3 // header, help and message lines
+}
+
+//scrollBy scrolls the log view by 'n' lines, and stops following the end.
+func (cmd *topCmd) scrollBy(n int) {
+	if cmd.job == nil {
+		return
+	}
+	lines := len(cmd.logLines())
+	if cmd.scroll < 0 {
+		cmd.scroll = lines - cmd.logHeight()
+	}
+	cmd.scroll += n
+	if cmd.scroll < 0 {
+		cmd.scroll = 0
+	}
+	if cmd.scroll >= lines-cmd.logHeight() {
+		cmd.scroll = -1
+	}
+}
+
+//duration returns the running time of the ongoing execution, or of the last build.
+func duration(j *format.Job) string {
+	for _, x := range []*format.Execution{j.GetRefresh(), j.GetBuild()} {
+		if x.GetStart() != 0 && x.GetEnd() < x.GetStart() {
+			return (time.Since(time.Unix(x.GetStart(), 0)) / time.Second * time.Second).String()
+		}
+	}
+	b := j.GetBuild()
+	if b.GetStart() == 0 {
+		return ""
+	}
+	return (time.Duration(b.GetEnd()-b.GetStart()) * time.Second).String()
+}
+
+//progress estimates a running build progress, from the previous successful build duration.
+func progress(j *format.Job) string {
+	b := j.GetBuild()
+	if j.State() != format.JobStatus_BUILDING {
+		return ""
+	}
+	var stage string
+	if n := len(j.GetStages()); n > 0 {
+		stage = " stage " + j.GetStages()[n-1].GetName()
+	}
+	for _, x := range j.GetHistory() {
+		if x.GetErrcode() == 0 && x.GetEnd() > x.GetStart() {
+			p := float64(time.Now().Unix()-b.GetStart()) / float64(x.GetEnd()-x.GetStart())
+			if p > 0.99 {
+				p = 0.99
+			}
+			n := int(p * 20)
+			return fmt.Sprintf("[%s%s] %2.0f%%%s", strings.Repeat("#", n), strings.Repeat(" ", 20-n), p*100, stage)
+		}
+	}
+	return strings.TrimSpace(stage)
+}
+
+//statusColor returns the terminal color of a status.
+func statusColor(s format.JobStatus) termbox.Attribute {
+	switch {
+	case s == format.JobStatus_SUCCESS:
+		return termbox.ColorGreen
+	case s.Failed():
+		return termbox.ColorRed
+	case s.Running() || s == format.JobStatus_QUEUED:
+		return termbox.ColorBlue
+	}
+	return termbox.ColorDefault
+}
+
+//short returns the first chars of a version.
+func short(version string) string {
+	if len(version) > 8 {
+		return version[:8]
+	}
+	return version
+}
+
+//pad right pads 's' with spaces up to 'w' chars.
+func pad(s string, w int) string {
+	if n := w - len([]rune(s)); n > 0 {
+		return s + strings.Repeat(" ", n)
+	}
+	return s
+}
+
+//text writes 's' at (x, y).
+func text(x, y int, fg, bg termbox.Attribute, s string) {
+	for _, r := range s {
+		termbox.SetCell(x, y, r, fg, bg)
+		x++
+	}
+}
+
+//jobsByName to sort jobs by their name
+type jobsByName []*format.Job
+
+func (a jobsByName) Len() int           { return len(a) }
+func (a jobsByName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a jobsByName) Less(i, j int) bool { return a[i].GetId().GetName() < a[j].GetId().GetName() }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ericaro/ci"
+	"github.com/ericaro/ci/format"
+)
+
+type versionCmd struct{}
+
+func (cmd *versionCmd) Flags(fs *flag.FlagSet) *flag.FlagSet { return fs }
+func (cmd *versionCmd) Run(args []string) {
+	c := client()
+
+	if len(args) != 0 {
+		fmt.Printf("version command requires no arguments. Got %v\n", len(args))
+		flag.Usage()
+		os.Exit(-1)
+	}
+
+	info, err := c.Info(context.Background())
+	if err != nil {
+		fatal(err)
+	}
+	err = render(info, func() {
+		fmt.Printf("client: version %s, protocol %d\n", ci.Version, format.ProtocolVersion)
+		fmt.Printf("daemon: version %s, protocol %d, at %s\n", info.GetVersion(), info.GetProtocol(), c.URL)
+		if info.GetProtocol() == 0 {
+			fmt.Printf("features: list, log, add, remove (the daemon predates the info request)\n")
+		} else {
+			fmt.Printf("features: %s\n", strings.Join(info.GetFeatures(), ", "))
+		}
+		if info.GetProtocol() > format.ProtocolVersion {
+			fmt.Println(color("00;31", "the daemon protocol is newer: upgrade this client."))
+		}
+	})
+	if err != nil {
+		fatal(err)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ericaro/ci/format"
+)
+
+//exit codes of the wait command
+const (
+	WaitSuccess = 0
+	WaitFailure = 1
+	WaitTimeout = 2
+)
+
+//longPoll is the maximum time of a single wait request, the command sends new
+// ones until its own timeout.
+const longPoll = 30 * time.Second
+
+type waitCmd struct {
+	version *string
+	timeout *time.Duration
+}
+
+func (cmd *waitCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.version = fs.String("version", "", "wait for a refresh to a version other than this one (e.g. the version before a push).")
+	cmd.timeout = fs.Duration("timeout", 30*time.Minute, "give up after this duration.")
+	return fs
+}
+func (cmd *waitCmd) Run(args []string) {
+	c := client()
+
+	if len(args) != 1 {
+		fmt.Printf("wait command requires 1 arguments. Got %v\n", len(args))
+		flag.Usage()
+		os.Exit(-1)
+	}
+	jobname := args[0]
+	deadline := time.Now().Add(*cmd.timeout)
+
+	var job *format.Job
+	for {
+		poll := deadline.Sub(time.Now())
+		if poll > longPoll {
+			poll = longPoll
+		}
+		j, done, err := c.WaitJob(context.Background(), jobname, *cmd.version, poll)
+		if _, ok := err.(*format.ServerError); ok {
+			fmt.Println(err.Error())
+			os.Exit(WaitFailure)
+		}
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		job = j
+		if done {
+			break
+		}
+		if !time.Now().Before(deadline) {
+			err := render(job, func() {
+				fmt.Printf("%s is still %s after %s\n", jobname, job.State().Label(), *cmd.timeout)
+			})
+			if err != nil {
+				log.Fatal(err.Error())
+			}
+			os.Exit(WaitTimeout)
+		}
+	}
+
+	s := job.State()
+	err := render(job, func() {
+		fmt.Printf("%s %s, version %s\n", jobname, s.Label(), job.GetRefresh().GetVersion())
+		fmt.Println("    ", newExec(job.GetRefresh(), "refresh").Summary())
+		if job.GetBuild().GetStart() != 0 {
+			fmt.Println("    ", newExec(job.GetBuild(), "build").Summary())
+		}
+		for _, st := range job.GetStages() {
+			fmt.Println("        ", newExec(st.GetExecution(), "stage "+st.GetName()).Summary())
+		}
+	})
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	if s != format.JobStatus_SUCCESS {
+		os.Exit(WaitFailure)
+	}
+}
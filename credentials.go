@@ -0,0 +1,319 @@
+package ci
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ericaro/ci/format"
+	"github.com/golang/protobuf/proto"
+)
+
+var (
+	//credentialHost matches the hosts of credentials, they are written in ssh and git configs.
+	credentialHost = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.-]*$`)
+	//credentialUser matches https usernames, they are written in a credential helper.
+	credentialUser = regexp.MustCompile(`^[A-Za-z0-9._@-]+$`)
+)
+
+//DefaultCredentialUser is the https username of tokens without one. Hosts that
+// authenticate with the token alone accept any username.
+const DefaultCredentialUser = "git"
+
+//credentials are the git credentials used to refresh jobs: ssh keys, and https
+// tokens, for a host, or for a single job's remote.
+//
+// They are applied to the git commands of a refresh through their environment,
+// see environ, and their secret is never returned.
+type credentials struct {
+	mu    sync.Mutex
+	creds map[string]*format.Credential // name -> credential
+}
+
+func newCredentials() *credentials {
+	return &credentials{creds: make(map[string]*format.Credential)}
+}
+
+//add creates a credential.
+func (c *credentials) add(cred *format.Credential) error {
+	name := cred.GetName()
+	if name == "" {
+		return format.Errorf(format.ErrorCode_INVALID_ARGUMENT, "cannot add a credential without a name.")
+	}
+	if (cred.GetHost() == "") == (cred.GetJobname() == "") {
+		return format.Errorf(format.ErrorCode_INVALID_ARGUMENT, "credential %q: expecting either a host, or a job.", name)
+	}
+	if cred.GetHost() != "" && !credentialHost.MatchString(cred.GetHost()) {
+		return format.Errorf(format.ErrorCode_INVALID_ARGUMENT, "credential %q: invalid host %q.", name, cred.GetHost())
+	}
+	secret := cred.GetSecret()
+	switch cred.GetKind() {
+	case format.CredentialKind_SSH_KEY:
+		if !strings.HasPrefix(strings.TrimSpace(secret), "-----BEGIN ") {
+			return format.Errorf(format.ErrorCode_INVALID_ARGUMENT, "credential %q: expecting a private key, in PEM or openssh format.", name)
+		}
+		if !strings.HasSuffix(secret, "\n") { // ssh rejects keys without a final newline
+			secret += "\n"
+		}
+	case format.CredentialKind_HTTPS_TOKEN:
+		secret = strings.TrimSpace(secret)
+		if secret == "" || strings.ContainsAny(secret, "\n\r") {
+			return format.Errorf(format.ErrorCode_INVALID_ARGUMENT, "credential %q: expecting a token, on a single line.", name)
+		}
+	default:
+		return format.Errorf(format.ErrorCode_INVALID_ARGUMENT, "credential %q: unknown kind %v.", name, cred.GetKind())
+	}
+	var user *string // ssh usernames are in the remotes
+	if cred.GetKind() == format.CredentialKind_HTTPS_TOKEN {
+		user = proto.String(DefaultCredentialUser)
+		if cred.GetUsername() != "" {
+			user = cred.Username
+		}
+		if !credentialUser.MatchString(*user) {
+			return format.Errorf(format.ErrorCode_INVALID_ARGUMENT, "credential %q: invalid username %q.", name, *user)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.creds[name]; exists {
+		return format.Errorf(format.ErrorCode_ALREADY_EXISTS, "a credential with this name already exists.")
+	}
+	c.creds[name] = &format.Credential{
+		Name:     cred.Name,
+		Kind:     cred.GetKind().Enum(),
+		Host:     cred.Host,
+		Jobname:  cred.Jobname,
+		Username: user,
+		Secret:   proto.String(secret),
+	}
+	return nil
+}
+
+//remove removes a credential.
+func (c *credentials) remove(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.creds[name]; !exists {
+		return format.Errorf(format.ErrorCode_NOT_FOUND, "no such credential %q.", name)
+	}
+	delete(c.creds, name)
+	return nil
+}
+
+//list returns the credentials, without their secret, sorted by name.
+func (c *credentials) list() []*format.Credential {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list := make([]*format.Credential, 0, len(c.creds))
+	for _, cred := range c.creds {
+		x := *cred
+		x.Secret = nil
+		list = append(list, &x)
+	}
+	sort.Sort(credentialsByName(list))
+	return list
+}
+
+type credentialsByName []*format.Credential
+
+func (x credentialsByName) Len() int           { return len(x) }
+func (x credentialsByName) Less(i, j int) bool { return x[i].GetName() < x[j].GetName() }
+func (x credentialsByName) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
+
+//marshal returns all the credentials, with their secret sealed by 's', to be
+// persisted. Without a key, credentials are not persisted.
+func (c *credentials) marshal(s *sealer) []*format.Credential {
+	if s == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list := make([]*format.Credential, 0, len(c.creds))
+	for _, cred := range c.creds {
+		x := *cred
+		x.Secret = nil
+		x.Sealed = s.seal("credential/"+cred.GetName(), cred.GetSecret())
+		list = append(list, &x)
+	}
+	sort.Sort(credentialsByName(list))
+	return list
+}
+
+//unmarshal replaces the credentials, with their secret opened by 's'. Credentials
+// that cannot be opened (e.g. with another key) are dropped.
+func (c *credentials) unmarshal(s *sealer, list []*format.Credential) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.creds = make(map[string]*format.Credential)
+	for _, cred := range list {
+		if s == nil || cred.Sealed == nil {
+			continue
+		}
+		secret, err := s.open("credential/"+cred.GetName(), cred.Sealed)
+		if err != nil {
+			log.Printf("error.daemon.credential:%q", fmt.Sprintf("%s: %s", cred.GetName(), err.Error()))
+			continue
+		}
+		x := *cred
+		x.Sealed = nil
+		x.Secret = proto.String(secret)
+		c.creds[cred.GetName()] = &x
+	}
+}
+
+//secrets returns the secrets of the credentials applied to the job 'name', with
+// the remote 'remote', to be redacted from its outputs. ssh keys are split in
+// lines: outputs are redacted line by line, not to hold back a whole key.
+func (c *credentials) secrets(name, remote string) []string {
+	var secrets []string
+	for _, cred := range c.forJob(name, remote) {
+		if cred.GetKind() != format.CredentialKind_SSH_KEY {
+			secrets = append(secrets, cred.GetSecret())
+			continue
+		}
+		for _, line := range strings.Split(cred.GetSecret(), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "-----") { // the BEGIN and END lines are not secret
+				secrets = append(secrets, line)
+			}
+		}
+	}
+	return secrets
+}
+
+//forJob returns the credentials applied to the job 'name', with the remote
+// 'remote', sorted by host: one per kind and host. Credentials of the job apply
+// to the host of its remote, over the credentials of that host.
+func (c *credentials) forJob(name, remote string) []*format.Credential {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	type key struct {
+		kind format.CredentialKind
+		host string
+	}
+	selected := make(map[key]*format.Credential)
+	for _, cred := range c.creds {
+		if cred.GetHost() == "" {
+			continue
+		}
+		k := key{cred.GetKind(), cred.GetHost()}
+		// on duplicates, the first name wins, so that the choice is stable.
+		if x, exists := selected[k]; !exists || cred.GetName() < x.GetName() {
+			selected[k] = cred
+		}
+	}
+	if host := remoteHost(remote); host != "" {
+		for _, cred := range c.creds {
+			if cred.GetJobname() != name {
+				continue
+			}
+			k := key{cred.GetKind(), host}
+			if x, exists := selected[k]; !exists || x.GetJobname() == "" || cred.GetName() < x.GetName() {
+				x := *cred
+				x.Host = proto.String(host)
+				selected[k] = &x
+			}
+		}
+	}
+	list := make([]*format.Credential, 0, len(selected))
+	for _, cred := range selected {
+		list = append(list, cred)
+	}
+	sort.Slice(list, func(a, b int) bool {
+		if list[a].GetHost() != list[b].GetHost() {
+			return list[a].GetHost() < list[b].GetHost()
+		}
+		return list[a].GetKind() < list[b].GetKind()
+	})
+	return list
+}
+
+//scpRemote matches scp-like remotes: [user@]host:path
+var scpRemote = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):`)
+
+//remoteHost returns the host of a git remote, without port, or "" for local remotes.
+func remoteHost(remote string) string {
+	if strings.Contains(remote, "://") {
+		u, err := url.Parse(remote)
+		if err != nil || u.Scheme == "file" {
+			return ""
+		}
+		return u.Hostname()
+	}
+	if m := scpRemote.FindStringSubmatch(remote); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+//environ returns the environment variables that apply the credentials of the
+// job 'name' to git, and a function to clean up the files they refer to.
+//
+// ssh keys are written in a private temporary directory, along with an ssh
+// config that selects them by host, and passed through GIT_SSH_COMMAND. https
+// tokens are passed in variables, read by a credential helper set for their
+// host through GIT_CONFIG_*: they never appear in a command line, or a file.
+func (c *credentials) environ(name, remote string) (env []string, cleanup func(), err error) {
+	cleanup = func() {}
+	creds := c.forJob(name, remote)
+	if len(creds) == 0 {
+		return nil, cleanup, nil
+	}
+	// git never prompts, the daemon has no terminal.
+	env = append(env, "GIT_TERMINAL_PROMPT=0")
+
+	var sshConfig, gitConfig []string
+	var dir string
+	for i, cred := range creds {
+		switch cred.GetKind() {
+		case format.CredentialKind_SSH_KEY:
+			if dir == "" {
+				if dir, err = ioutil.TempDir("", "ci-credentials-"); err != nil {
+					return nil, cleanup, err
+				}
+				cleanup = func() { os.RemoveAll(dir) }
+			}
+			key := filepath.Join(dir, "key-"+strconv.Itoa(i))
+			if err := ioutil.WriteFile(key, []byte(cred.GetSecret()), 0600); err != nil {
+				cleanup()
+				return nil, func() {}, err
+			}
+			sshConfig = append(sshConfig, "Host "+cred.GetHost(), "  IdentityFile "+key, "  IdentitiesOnly yes")
+
+		case format.CredentialKind_HTTPS_TOKEN:
+			token := "CI_GIT_TOKEN_" + strconv.Itoa(i)
+			helper := fmt.Sprintf(`!f() { test "$1" = get || return 0; echo username=%s; echo "password=$%s"; }; f`, cred.GetUsername(), token)
+			// an empty helper first resets the helpers of the daemon user for this host.
+			gitConfig = append(gitConfig, "credential.https://"+cred.GetHost()+".helper", "", "credential.https://"+cred.GetHost()+".helper", helper)
+			env = append(env, token+"="+cred.GetSecret())
+		}
+	}
+
+	if len(sshConfig) > 0 {
+		// the daemon user's config still applies to the other settings, and hosts.
+		sshConfig = append(sshConfig, "Match all", "  Include ~/.ssh/config", "")
+		config := filepath.Join(dir, "config")
+		if err := ioutil.WriteFile(config, []byte(strings.Join(sshConfig, "\n")), 0600); err != nil {
+			cleanup()
+			return nil, func() {}, err
+		}
+		env = append(env, "GIT_SSH_COMMAND=ssh -F '"+config+"' -o BatchMode=yes")
+	}
+	if len(gitConfig) > 0 {
+		n := len(gitConfig) / 2
+		env = append(env, "GIT_CONFIG_COUNT="+strconv.Itoa(n))
+		for i := 0; i < n; i++ {
+			env = append(env, fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", i, gitConfig[2*i]), fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", i, gitConfig[2*i+1]))
+		}
+	}
+	return env, cleanup, nil
+}
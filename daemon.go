@@ -8,12 +8,19 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/ericaro/ci/format"
 	"github.com/golang/protobuf/proto"
 )
 
+//Version is the daemon version, reported by the info request. Release builds set it with
+//    go build -ldflags "-X github.com/ericaro/ci.Version=1.2.0"
+var Version = "dev"
+
 type Status int
 
 const (
@@ -28,10 +35,30 @@ type Daemon interface {
 	HeartBeats()
 	//
 	Status() Status
-	AddJob(path, remote, branch string) error
+	AddJob(path, remote, branch string, labels, env, secrets map[string]string) error
 	RemoveJob(path string) error
-	ListJobs(refreshResult, buildResult bool) *format.ListResponse
-	JobDetails(job string) *format.LogResponse
+	BuildJob(path string, force bool) error
+	CancelJob(path string) error
+	WaitJob(path, version string, timeout time.Duration) (*format.Job, bool, error)
+	ApplyJobs(jobs []*format.Jobid, prune, dryrun bool) (*format.ApplyResponse, error)
+	ExportJobs(history bool) *format.ExportResponse
+	ImportJobs(jobs []*format.Job, overwrite bool) (*format.ImportResponse, error)
+	ListJobs(refreshResult, buildResult, history bool, selector []*format.Label) *format.ListResponse
+	JobDetails(job string) (*format.LogResponse, error)
+	WatchJobs(q *format.WatchRequest) *format.WatchResponse
+	// Events returns the journal of job events, see format.EventsRequest.
+	Events(q *format.EventsRequest) *format.EventsResponse
+	// Subscribe returns a channel receiving the next job events, and a function to unsubscribe.
+	Subscribe() (<-chan *format.Event, func())
+	AddHook(h *format.Hook) error
+	RemoveHook(name string) error
+	// Hooks returns the outgoing webhooks, without their secret, and their deliveries.
+	Hooks(q *format.HooksRequest) *format.HooksResponse
+	Redeliver(delivery int64) (*format.Delivery, error)
+	AddCredential(cred *format.Credential) error
+	RemoveCredential(name string) error
+	// Credentials returns the git credentials, without their secret.
+	Credentials() []*format.Credential
 	Marshal() *format.Server
 	Unmarshal(*format.Server) error
 }
@@ -39,7 +66,15 @@ type Daemon interface {
 func NewDaemon(wd, dbfile string) (daemon Daemon, err error) {
 
 	//Creates the daemon
-	daemon = &ci{wd: wd, jobs: make(map[string]*job)}
+	c := &ci{wd: wd, jobs: make(map[string]*job), revs: newRevisions(), removed: make(map[string]uint64), bus: newBus(), creds: newCredentials()}
+	c.hooks = newHooks(c.jobStatus)
+	daemon = c
+
+	// the key to the job and hook secrets, and credentials, before reading them
+	if c.sealer, err = loadKey(dbfile + ".key"); err != nil {
+		log.Printf("error.daemon.key:%q", err.Error())
+		return daemon, err
+	}
 
 	// read from disk if needed
 	_, err = os.Stat(dbfile)
@@ -75,18 +110,31 @@ func NewDaemon(wd, dbfile string) (daemon Daemon, err error) {
 			return daemon, err
 		}
 	}
+	// the events journal lives next to the db
+	if err := c.bus.openJournal(dbfile + ".events"); err != nil {
+		log.Printf("error.daemon.journal:%q", err.Error())
+		return daemon, err
+	}
+	// so does the webhooks delivery log
+	if err := c.hooks.openLog(dbfile + ".deliveries"); err != nil {
+		log.Printf("error.daemon.deliveries:%q", err.Error())
+		return daemon, err
+	}
+	events, _ := c.bus.Subscribe()
+	go c.hooks.run(events)
+
 	// now the ci is fully created or unmarshaled
 	//just log the job found
-	for i, n := range daemon.ListJobs(false, false).GetJobs() {
+	for i, n := range daemon.ListJobs(false, false, false, nil).GetJobs() {
 		log.Printf("    daemon.job[%v]:%q,\n", i, n.GetId().GetName())
 	}
 	log.Printf("daemon.ready")
 
 	// register a syscall hook to persist it on exit
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, os.Kill, syscall.SIGTERM)
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, os.Kill, syscall.SIGTERM)
 	go func() {
-		for _ = range c {
+		for _ = range sig {
 			// sig is a ^C, handle it
 			b, err := proto.Marshal(daemon.Marshal())
 			if err != nil {
@@ -109,25 +157,41 @@ func NewDaemon(wd, dbfile string) (daemon Daemon, err error) {
 
 // ci is a collection of jobs. It implements Server
 type ci struct {
+	mu         sync.Mutex      // protects jobs
 	jobs       map[string]*job // path -> job
 	wd         string          // absolute path to the working dir
 	heartbeats int
+	revs       *revisions        // job state revisions, see WatchJobs
+	removed    map[string]uint64 // path -> revision of removed jobs, protected by mu
+	forgotten  uint64            // the last revision dropped from removed, protected by mu
+	bus        *bus              // job events, see Events
+	hooks      *hooks            // outgoing webhooks
+	sealer     *sealer           // encrypts the secrets in the db, nil to not persist them
+	creds      *credentials      // git credentials, applied to the refreshes
 }
 
 // return a message describing the full details of a job.
-func (c *ci) JobDetails(job string) *format.LogResponse {
-	j := c.jobs[job]
-	return &format.LogResponse{
-		Job: j.Status(true, true),
+func (c *ci) JobDetails(job string) (*format.LogResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	j, exists := c.jobs[job]
+	if !exists {
+		return nil, format.Errorf(format.ErrorCode_NOT_FOUND, "no such job %q.", job)
 	}
+	return &format.LogResponse{
+		Job: j.Details(),
+	}, nil
 }
 
 func (c *ci) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	for _, j := range c.jobs {
-		if j.State() == StatusKO {
+		s := j.Status(false, false).GetStatus()
+		if s.Failed() {
 			return StatusKO
 		}
-		if j.State() == StatusRunning {
+		if s.Running() {
 			return StatusRunning
 		}
 	}
@@ -141,11 +205,22 @@ func (c *ci) Jobs() map[string]*job {
 
 //ListJobs return a format.ListResponse describing all jobs.
 // refreshResult = true means to add the output of the refresh action.
-func (c *ci) ListJobs(refreshResult, buildResult bool) *format.ListResponse {
+// history = true means to add the build history.
+// selector, if not empty, restricts the list to jobs having all these labels.
+func (c *ci) ListJobs(refreshResult, buildResult, history bool, selector []*format.Label) *format.ListResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	js := make([]*format.Job, 0, len(c.jobs))
 	for _, j := range c.jobs {
-		js = append(js, j.Status(refreshResult, buildResult))
+		s := j.Status(refreshResult, buildResult)
+		if !s.GetId().Matches(selector) {
+			continue
+		}
+		if history {
+			s.History = j.History()
+		}
+		js = append(js, s)
 	}
 
 	return &format.ListResponse{
@@ -155,54 +230,531 @@ func (c *ci) ListJobs(refreshResult, buildResult bool) *format.ListResponse {
 
 //HeartBeat count incoming commits, and schedule a build
 func (c *ci) HeartBeats() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.heartbeats++
 	for _, j := range c.jobs {
 		j.Run() // I don't need to fork here, because Run() already handles that.
 	}
 }
 
-func (c *ci) AddJob(path, remote, branch string) error {
+func (c *ci) AddJob(path, remote, branch string, labels, env, secrets map[string]string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if _, exists := c.jobs[path]; exists {
-		return fmt.Errorf("a job with this name already exists.")
-	}
-	c.jobs[path] = &job{name: path,
-		remote: remote,
-		branch: branch,
+		return format.Errorf(format.ErrorCode_ALREADY_EXISTS, "a job with this name already exists.")
 	}
+	c.put(&job{name: path,
+		remote:  remote,
+		branch:  branch,
+		labels:  labels,
+		env:     env,
+		secrets: keepSecrets(nil, secrets),
+	})
+	c.emit(format.EventType_JOB_ADDED, path, "")
 	return nil
 }
 
 func (c *ci) RemoveJob(path string) error {
-	if _, exists := c.jobs[path]; exists {
+	c.mu.Lock()
+	j := c.removeJob(path)
+	c.mu.Unlock() // do not block the daemon while the job stops
+	if j == nil {
+		return format.Errorf(format.ErrorCode_NOT_FOUND, "no such job %q.", path)
+	}
+	return discard(j)
+}
 
-		//remove from the daemon server
-		delete(c.jobs, path)
+//BuildJob schedules an immediate run of the job.
+//
+// With 'force' the job is built even if its version has already been built.
+func (c *ci) BuildJob(path string, force bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	j, exists := c.jobs[path]
+	if !exists {
+		return format.Errorf(format.ErrorCode_NOT_FOUND, "no such job %q.", path)
+	}
+	if force {
+		j.force = true
+	}
+	j.RunWithDelay(0)
+	return nil
+}
 
-		//remove from local filesystem
-		if err := os.RemoveAll(path); err != nil {
-			if os.IsNotExist(err) {
-				return nil //ok
-			} else {
-				return fmt.Errorf("cannot removing job's local directory: %s", err.Error())
+//CancelJob stops the job's ongoing run, and unschedule the next one.
+func (c *ci) CancelJob(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	j, exists := c.jobs[path]
+	if !exists {
+		return format.Errorf(format.ErrorCode_NOT_FOUND, "no such job %q.", path)
+	}
+	if !j.Cancel() {
+		return format.Errorf(format.ErrorCode_INVALID_ARGUMENT, "job %q is neither running nor scheduled.", path)
+	}
+	return nil
+}
+
+//MaxWait caps the time a WaitJob can last, long-polls should not hang forever.
+const MaxWait = time.Minute
+
+//WaitJob waits until the job is done: neither running nor scheduled, and if
+// 'version' is not empty, refreshed to another version, or failed to refresh.
+//
+// It returns the job status, and false if 'timeout' (or MaxWait) expired first,
+// or a NOT_FOUND error if the job is removed meanwhile.
+func (c *ci) WaitJob(path, version string, timeout time.Duration) (*format.Job, bool, error) {
+	if timeout <= 0 || timeout > MaxWait {
+		timeout = MaxWait
+	}
+	expired := time.After(timeout)
+	var waited *job         // the job waited for, it changes if an import replaces it
+	var refreshed time.Time // the start of its last refresh, when the wait started
+	for {
+		c.mu.Lock()
+		j, exists := c.jobs[path]
+		c.mu.Unlock() // do not block the daemon while waiting
+		if !exists {
+			return nil, false, format.Errorf(format.ErrorCode_NOT_FOUND, "no such job %q.", path)
+		}
+		changed := j.Changed() // before reading the status, not to miss a change
+		s := j.Status(false, false)
+		if j != waited {
+			waited, refreshed = j, j.refresh.start
+		}
+		st := s.GetStatus()
+		// a failed refresh does not change the version, it is done all the same.
+		failed := !j.refresh.start.Equal(refreshed) && s.GetRefresh().GetErrcode() != 0
+		if !st.Running() && st != format.JobStatus_QUEUED && (version == "" || s.GetRefresh().GetVersion() != version || failed) {
+			return s, true, nil
+		}
+		select {
+		case <-changed:
+		case <-expired:
+			return s, false, nil
+		}
+	}
+}
 
+//WatchJobs waits until a job changes after the 'revision' of the request, or until
+// its timeout (capped by MaxWait) expires.
+//
+// It returns the jobs changed since 'revision', or all jobs if 'revision' is
+// from before the daemon started (e.g. 0), or older than the removals the daemon
+// remembers (see RemovedSize), and the current revision.
+func (c *ci) WatchJobs(q *format.WatchRequest) *format.WatchResponse {
+	timeout := time.Duration(q.GetTimeout()) * time.Second
+	if timeout <= 0 || timeout > MaxWait {
+		timeout = MaxWait
+	}
+	expired := time.After(timeout)
+	for {
+		resp, changed := c.changes(q)
+		if resp.GetFull() || len(resp.Jobs) > 0 || len(resp.Removed) > 0 {
+			return resp
+		}
+		select {
+		case <-changed:
+		case <-expired:
+			return resp
+		}
+	}
+}
+
+//changes returns the jobs changed since the request revision, and a channel
+// closed on the next change.
+func (c *ci) changes(q *format.WatchRequest) (*format.WatchResponse, <-chan struct{}) {
+	start, current, changed := c.revs.get() // before reading the jobs, not to miss a change
+	since := q.GetRevision()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	full := since < start || since < c.forgotten
+	resp := &format.WatchResponse{Revision: &current, Full: &full}
+	for name, j := range c.jobs {
+		if q.Jobname != nil && name != q.GetJobname() {
+			continue
+		}
+		if !full && j.Revision() <= since {
+			continue
+		}
+		s := j.Status(q.GetRefreshResult(), q.GetBuildResult())
+		if !s.GetId().Matches(q.GetSelector()) {
+			if !full { // its labels may have changed, the client must forget it
+				resp.Removed = append(resp.Removed, name)
+			}
+			continue
+		}
+		if q.GetHistory() {
+			s.History = j.History()
+		}
+		resp.Jobs = append(resp.Jobs, s)
+	}
+	if !full {
+		for name, rev := range c.removed {
+			if rev > since && (q.Jobname == nil || name == q.GetJobname()) {
+				resp.Removed = append(resp.Removed, name)
 			}
 		}
+	}
+	sort.Strings(resp.Removed)
+	return resp, changed
+}
+
+//put adds, or replaces a job. c.mu must be held.
+func (c *ci) put(j *job) {
+	j.revs = c.revs
+	j.bus = c.bus
+	j.creds = c.creds
+	c.jobs[j.name] = j
+	delete(c.removed, j.name)
+	j.notify()
+}
+
+//RemovedSize is the number of removed jobs remembered for watch requests.
+const RemovedSize = 1000
+
+//forget drops the oldest removed jobs, beyond RemovedSize. Watchers that ask for
+// an older revision get all the jobs. c.mu must be held.
+func (c *ci) forget() {
+	if len(c.removed) <= RemovedSize {
+		return
+	}
+	revs := make([]uint64, 0, len(c.removed))
+	for _, rev := range c.removed {
+		revs = append(revs, rev)
+	}
+	sort.Slice(revs, func(i, j int) bool { return revs[i] < revs[j] })
+	last := revs[len(revs)-RemovedSize-1] // the last one to drop
+	for name, rev := range c.removed {
+		if rev <= last {
+			delete(c.removed, name)
+		}
+	}
+	if last > c.forgotten {
+		c.forgotten = last
+	}
+}
+
+//removeJob removes the job from the daemon, and returns it, or nil if there is
+// none. It must then be discarded, once c.mu is released. c.mu must be held.
+func (c *ci) removeJob(path string) *job {
+	j, exists := c.jobs[path]
+	if !exists {
+		return nil
+	}
+	//remove from the daemon server
+	delete(c.jobs, path)
+	c.removed[path] = c.revs.next()
+	c.forget()
+	c.emit(format.EventType_JOB_REMOVED, path, "")
+	return j
+}
+
+//discard stops a removed job, waiting for its current execution, and then
+// removes its local directory. c.mu must not be held.
+func discard(j *job) error {
+	j.Stop()
 
+	//remove from local filesystem
+	if err := os.RemoveAll(j.name); err != nil {
+		if os.IsNotExist(err) {
+			return nil //ok
+		} else {
+			return fmt.Errorf("cannot removing job's local directory: %s", err.Error())
+
+		}
 	}
 	return nil
 }
 
+//ApplyJobs reconciles the current jobs with 'jobs': missing jobs are added,
+// jobs whose remote or branch differ are updated, and if 'prune' is true, jobs
+// that are not in 'jobs' are removed.
+//
+// With 'dryrun' nothing is changed, the returned diff is what would have been applied.
+func (c *ci) ApplyJobs(jobs []*format.Jobid, prune, dryrun bool) (*format.ApplyResponse, error) {
+
+	// validate everything first, an apply is all or nothing.
+	declared := make(map[string]bool)
+	labels := make([]map[string]string, len(jobs))
+	env := make([]map[string]string, len(jobs))
+	secrets := make([]map[string]string, len(jobs))
+	for i, id := range jobs {
+		name := id.GetName()
+		if name == "" {
+			return nil, format.Errorf(format.ErrorCode_INVALID_ARGUMENT, "cannot apply a job without a name.")
+		}
+		if declared[name] {
+			return nil, format.Errorf(format.ErrorCode_INVALID_ARGUMENT, "job %q is declared twice.", name)
+		}
+		declared[name] = true
+		l, err := format.LabelMap(id.GetLabels())
+		if err != nil {
+			return nil, format.Errorf(format.ErrorCode_INVALID_ARGUMENT, "job %q: %s.", name, err.Error())
+		}
+		labels[i] = l
+		if env[i], err = format.VariableMap(id.GetEnv()); err != nil {
+			return nil, format.Errorf(format.ErrorCode_INVALID_ARGUMENT, "job %q: %s.", name, err.Error())
+		}
+		if secrets[i], err = format.SecretMap(id.GetSecrets()); err != nil {
+			return nil, format.Errorf(format.ErrorCode_INVALID_ARGUMENT, "job %q: %s.", name, err.Error())
+		}
+	}
+
+	c.mu.Lock()
+	resp := new(format.ApplyResponse)
+	var updated []int // index in 'jobs'
+	for i, id := range jobs {
+		name := id.GetName()
+		j, exists := c.jobs[name]
+		switch {
+		case !exists:
+			resp.Added = append(resp.Added, name)
+			if !dryrun {
+				c.put(&job{name: name, remote: id.GetRemote(), branch: id.GetBranch(), labels: labels[i], env: env[i], secrets: keepSecrets(nil, secrets[i])})
+				c.emit(format.EventType_JOB_ADDED, name, "applied")
+			}
+		case j.remote != id.GetRemote() || j.branch != id.GetBranch() || !sameMap(j.labels, labels[i]) ||
+			!sameMap(j.env, env[i]) || !sameMap(j.secrets, keepSecrets(j.secrets, secrets[i])):
+			resp.Updated = append(resp.Updated, name)
+			updated = append(updated, i)
+		}
+	}
+	if prune {
+		for name := range c.jobs {
+			if !declared[name] {
+				resp.Removed = append(resp.Removed, name)
+			}
+		}
+	}
+	var removed []*job
+	if !dryrun {
+		for _, name := range resp.Removed {
+			removed = append(removed, c.removeJob(name))
+		}
+	}
+	// grab the jobs to update while we still hold the lock.
+	toupdate := make([]*job, 0, len(updated))
+	for _, i := range updated {
+		toupdate = append(toupdate, c.jobs[jobs[i].GetName()])
+	}
+	c.mu.Unlock()
+
+	var err error
+	// removed jobs are stopped, and updates wait for the job to be idle, without
+	// blocking the whole daemon.
+	for _, j := range removed {
+		if e := discard(j); e != nil && err == nil {
+			err = e
+		}
+	}
+	if !dryrun {
+		for k, j := range toupdate {
+			i := updated[k]
+			id := jobs[i]
+			if e := j.Update(id.GetRemote(), id.GetBranch(), labels[i], env[i], secrets[i]); e != nil {
+				if err == nil {
+					err = e
+				}
+				continue
+			}
+			c.emit(format.EventType_JOB_UPDATED, j.name, "applied")
+		}
+	}
+
+	sort.Strings(resp.Added)
+	sort.Strings(resp.Updated)
+	sort.Strings(resp.Removed)
+	return resp, err
+}
+
+//ExportJobs returns all job definitions sorted by name, and with 'history' their
+// executions too.
+func (c *ci) ExportJobs(history bool) *format.ExportResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.jobs))
+	for name := range c.jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	jobs := make([]*format.Job, 0, len(names))
+	for _, name := range names {
+		j := c.jobs[name]
+		if history {
+			jobs = append(jobs, j.Marshal())
+		} else {
+			jobs = append(jobs, &format.Job{Id: j.Status(false, false).Id})
+		}
+	}
+	return &format.ExportResponse{Jobs: jobs}
+}
+
+//ImportJobs creates jobs from their messages, restoring their executions if any.
+//
+// Jobs whose name already exists are skipped, unless 'overwrite' is true.
+func (c *ci) ImportJobs(jobs []*format.Job, overwrite bool) (*format.ImportResponse, error) {
+
+	// validate everything first, an import is all or nothing.
+	imported := make([]*job, 0, len(jobs))
+	declared := make(map[string]bool)
+	for _, f := range jobs {
+		jb := new(job)
+		if err := jb.Unmarshal(f); err != nil {
+			return nil, format.Errorf(format.ErrorCode_INVALID_ARGUMENT, "invalid job %q: %s", f.GetId().GetName(), err.Error())
+		}
+		if jb.name == "" {
+			return nil, format.Errorf(format.ErrorCode_INVALID_ARGUMENT, "cannot import a job without a name.")
+		}
+		if declared[jb.name] {
+			return nil, format.Errorf(format.ErrorCode_INVALID_ARGUMENT, "job %q is declared twice.", jb.name)
+		}
+		declared[jb.name] = true
+		imported = append(imported, jb)
+	}
+
+	c.mu.Lock()
+	resp := new(format.ImportResponse)
+	var replaced, replacing []*job // the overwritten jobs, and their new job
+	for _, jb := range imported {
+		old, exists := c.jobs[jb.name]
+		if exists && !overwrite {
+			resp.Skipped = append(resp.Skipped, jb.name)
+			continue
+		}
+		if exists {
+			jb.secrets = keepSecrets(old.secrets, jb.secrets)
+			// the new job does not execute until the replaced one is stopped.
+			jb.execLock.Lock()
+			replaced = append(replaced, old)
+			replacing = append(replacing, jb)
+		} else {
+			jb.secrets = keepSecrets(nil, jb.secrets)
+		}
+		c.put(jb)
+		if exists {
+			c.emit(format.EventType_JOB_UPDATED, jb.name, "overwritten by an import")
+		} else {
+			c.emit(format.EventType_JOB_ADDED, jb.name, "imported")
+		}
+		resp.Imported = append(resp.Imported, jb.name)
+	}
+	c.mu.Unlock()
+
+	// replaced jobs are stopped one at a time, without blocking the whole daemon.
+	var err error
+	for i, old := range replaced {
+		jb := replacing[i]
+		old.Stop()
+		if old.remote != jb.remote || old.branch != jb.branch {
+			// the local checkout belongs to the previous remote.
+			if e := os.RemoveAll(jb.name); e != nil && !os.IsNotExist(e) && err == nil {
+				err = fmt.Errorf("cannot remove job's local directory: %s", e.Error())
+			}
+		}
+		jb.execLock.Unlock()
+	}
+	return resp, err
+}
+
+//Events returns the journal events matching 'q', see bus.Events.
+func (c *ci) Events(q *format.EventsRequest) *format.EventsResponse { return c.bus.Events(q) }
+
+//Subscribe returns a channel receiving the next job events, and a function to unsubscribe.
+func (c *ci) Subscribe() (<-chan *format.Event, func()) { return c.bus.Subscribe() }
+
+//AddHook creates an outgoing webhook, see format.Hook.
+func (c *ci) AddHook(h *format.Hook) error { return c.hooks.add(h) }
+
+//RemoveHook removes an outgoing webhook.
+func (c *ci) RemoveHook(name string) error { return c.hooks.remove(name) }
+
+//Hooks returns the outgoing webhooks, without their secret, and their deliveries.
+func (c *ci) Hooks(q *format.HooksRequest) *format.HooksResponse { return c.hooks.list(q) }
+
+//Redeliver sends the payload of a previous delivery again.
+func (c *ci) Redeliver(delivery int64) (*format.Delivery, error) { return c.hooks.redeliver(delivery) }
+
+//AddCredential creates git credentials, see format.Credential.
+func (c *ci) AddCredential(cred *format.Credential) error { return c.creds.add(cred) }
+
+//RemoveCredential removes git credentials.
+func (c *ci) RemoveCredential(name string) error { return c.creds.remove(name) }
+
+//Credentials returns the git credentials, without their secret.
+func (c *ci) Credentials() []*format.Credential { return c.creds.list() }
+
+//jobStatus returns the job status, without outputs, or nil if there is no such job.
+func (c *ci) jobStatus(name string) *format.Job {
+	c.mu.Lock()
+	j, exists := c.jobs[name]
+	c.mu.Unlock()
+	if !exists {
+		return nil
+	}
+	return j.Status(false, false)
+}
+
+//emit publishes a daemon event about the job 'name'.
+func (c *ci) emit(t format.EventType, name, detail string) {
+	e := &format.Event{Type: t.Enum(), Jobname: &name}
+	if detail != "" {
+		e.Detail = &detail
+	}
+	c.bus.publish(e)
+}
+
 // the main feature for a ci is to edit jobs, and persist them.
 
 func (c *ci) Marshal() *format.Server {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	jobs := make([]*format.Job, 0, 100)
 	for _, j := range c.jobs {
-		jobs = append(jobs, j.Marshal())
+		f := j.Marshal()
+		f.Id.Secrets = c.seal(j)
+		jobs = append(jobs, f)
+	}
+	return &format.Server{Jobs: jobs, Hooks: c.hooks.marshal(c.sealer), Credentials: c.creds.marshal(c.sealer)}
+}
+
+//seal returns the job secrets, with their value sealed. Without a key, secrets
+// are not persisted.
+func (c *ci) seal(j *job) []*format.Secret {
+	if c.sealer == nil {
+		return nil
+	}
+	secrets := format.SecretNames(j.secrets)
+	for _, s := range secrets {
+		s.Sealed = c.sealer.seal(j.name+"/"+s.GetName(), j.secrets[s.GetName()])
+	}
+	return secrets
+}
+
+//open sets the value of the job secrets sealed in 'f'. Secrets that cannot be
+// opened (e.g. with another key) are dropped.
+func (c *ci) open(j *job, f *format.Job) {
+	j.secrets = make(map[string]string)
+	for _, s := range f.GetId().GetSecrets() {
+		if c.sealer == nil || s.Sealed == nil {
+			continue
+		}
+		value, err := c.sealer.open(j.name+"/"+s.GetName(), s.Sealed)
+		if err != nil {
+			log.Printf("error.daemon.secret:%q", fmt.Sprintf("%s %s: %s", j.name, s.GetName(), err.Error()))
+			continue
+		}
+		j.secrets[s.GetName()] = value
 	}
-	return &format.Server{Jobs: jobs}
 }
 
 func (c *ci) Unmarshal(f *format.Server) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	// clean up the current object
 	c.jobs = make(map[string]*job)
@@ -211,8 +763,11 @@ func (c *ci) Unmarshal(f *format.Server) error {
 
 		jb := job{}
 		jb.Unmarshal(j)
-		c.jobs[jb.name] = &jb
+		c.open(&jb, j)
+		c.put(&jb)
 
 	}
+	c.hooks.unmarshal(c.sealer, f.GetHooks())
+	c.creds.unmarshal(c.sealer, f.GetCredentials())
 	return nil
 }
@@ -0,0 +1,295 @@
+package ci
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ericaro/ci/format"
+)
+
+//JournalSize is the number of events kept in the journal.
+const JournalSize = 1000
+
+//DefaultEvents is the number of events returned by an events request without limit.
+const DefaultEvents = 100
+
+//bus publishes the job lifecycle events to subscribers, and to the journal: the
+// last JournalSize events, kept in memory, and appended to a file (one json
+// event per line, see journal) if the journal is persisted.
+type bus struct {
+	mu      sync.Mutex
+	last    int64                       // id of the last event
+	events  []*format.Event             // the journal, oldest first
+	subs    map[chan *format.Event]bool // subscribers, see Subscribe
+	changed chan struct{}               // closed on the next event, see query
+	file    *journal                    // the journal file, nil if not persisted
+}
+
+func newBus() *bus {
+	return &bus{subs: make(map[chan *format.Event]bool)}
+}
+
+//openJournal loads the journal from 'filename' (one json event per line), and
+// appends the next events to it.
+//
+// The file is compacted to the last JournalSize events first, and again each time
+// it holds twice as many.
+func (b *bus) openJournal(filename string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	err := readJournal(filename, func(data []byte) error {
+		e := new(format.Event)
+		if err := json.Unmarshal(data, e); err != nil {
+			return err
+		}
+		b.append(e)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, e := range b.events {
+		if e.GetId() > b.last {
+			b.last = e.GetId()
+		}
+	}
+	file := &journal{filename: filename, size: JournalSize}
+	if err := file.rewrite(b.values()); err != nil {
+		return err
+	}
+	b.file = file
+	return nil
+}
+
+//values returns the events of the journal, to be written. b.mu must be held.
+func (b *bus) values() []interface{} {
+	values := make([]interface{}, 0, len(b.events))
+	for _, e := range b.events {
+		values = append(values, e)
+	}
+	return values
+}
+
+//readJournal calls 'read' with each line of the json journal 'filename', if it exists.
+//
+// Lines that cannot be read are skipped: a truncated line, if the daemon was
+// killed while writing it.
+func readJournal(filename string, read func(data []byte) error) error {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20) // deliveries hold their payload
+	for scanner.Scan() {
+		if err := read(scanner.Bytes()); err != nil {
+			log.Printf("error.daemon.journal.parsing:%q", err.Error())
+		}
+	}
+	return scanner.Err()
+}
+
+//journal is a json journal file, opened to append values, one per line. It
+// counts its lines, to be compacted when they pass twice its size.
+type journal struct {
+	filename string
+	size     int      // the number of values kept by a compaction
+	file     *os.File // nil until the first rewrite
+	lines    int      // the number of lines in the file
+}
+
+//rewrite replaces the journal file with 'values'. On error, the previous file is
+// still appended to.
+func (j *journal) rewrite(values []interface{}) error {
+	file, err := writeJournal(j.filename, values)
+	if err != nil {
+		return err
+	}
+	if j.file != nil {
+		j.file.Close()
+	}
+	j.file, j.lines = file, len(values)
+	return nil
+}
+
+//append writes 'v' to the journal. When the journal holds more than twice its
+// size, it is rewritten with 'current()': the values to keep, 'v' included.
+func (j *journal) append(v interface{}, current func() []interface{}) error {
+	if err := writeJSON(j.file, v); err != nil {
+		return err
+	}
+	j.lines++
+	if j.lines > 2*j.size {
+		return j.rewrite(current())
+	}
+	return nil
+}
+
+//writeJournal replaces the json journal 'filename' with 'values', and opens it to
+// append the next ones (see writeJSON).
+func writeJournal(filename string, values []interface{}) (*os.File, error) {
+	tmp := filename + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(file)
+	for _, v := range values {
+		if err := writeJSON(w, v); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	file.Close()
+	if err := os.Rename(tmp, filename); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+}
+
+//writeJSON writes 'v' as a json line.
+func writeJSON(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+//append adds 'e' to the journal, dropping the oldest events. b.mu must be held.
+func (b *bus) append(e *format.Event) {
+	b.events = append(b.events, e)
+	if len(b.events) > JournalSize {
+		b.events = append(b.events[:0], b.events[len(b.events)-JournalSize:]...)
+	}
+}
+
+//publish sets the event id and time, journals it, and sends it to every subscriber.
+//
+// It never blocks: a subscriber that does not keep up misses events.
+func (b *bus) publish(e *format.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.last++
+	id, now := b.last, time.Now().Unix()
+	e.Id, e.Time = &id, &now
+
+	b.append(e)
+	if b.file != nil {
+		if err := b.file.append(e, b.values); err != nil {
+			log.Printf("error.daemon.journal.writing:%q", err.Error())
+		}
+	}
+	if b.changed != nil {
+		close(b.changed)
+		b.changed = nil
+	}
+	for s := range b.subs {
+		select {
+		case s <- e:
+		default:
+			log.Printf("error.daemon.event.dropped:%q", e.String())
+		}
+	}
+}
+
+//Subscribe returns a channel receiving all the next events, and a function to
+// stop receiving them.
+func (b *bus) Subscribe() (<-chan *format.Event, func()) {
+	s := make(chan *format.Event, 64)
+	b.mu.Lock()
+	b.subs[s] = true
+	b.mu.Unlock()
+	return s, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs, s)
+	}
+}
+
+//Events returns the last 'limit' events of the journal matching 'q', oldest
+// first. If there is none, it waits for one until the request timeout (capped by
+// MaxWait) expires.
+func (b *bus) Events(q *format.EventsRequest) *format.EventsResponse {
+	timeout := time.Duration(q.GetTimeout()) * time.Second
+	if timeout > MaxWait {
+		timeout = MaxWait
+	}
+	expired := time.After(timeout)
+	for {
+		events, changed := b.query(q)
+		if len(events) > 0 || timeout <= 0 {
+			return &format.EventsResponse{Events: events}
+		}
+		select {
+		case <-changed:
+		case <-expired:
+			return &format.EventsResponse{}
+		}
+	}
+}
+
+//query returns the events matching 'q', and a channel closed on the next event.
+func (b *bus) query(q *format.EventsRequest) ([]*format.Event, <-chan struct{}) {
+	limit := int(q.GetLimit())
+	if limit <= 0 {
+		limit = DefaultEvents
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var events []*format.Event
+	for i := len(b.events) - 1; i >= 0 && len(events) < limit; i-- {
+		e := b.events[i]
+		if e.GetId() <= q.GetSince() {
+			break
+		}
+		if q.GetJobname() == "" || e.GetJobname() == q.GetJobname() {
+			events = append(events, e)
+		}
+	}
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	if b.changed == nil {
+		b.changed = make(chan struct{})
+	}
+	return events, b.changed
+}
+
+//emit publishes a job event. For finished events, it includes the 'x' errcode.
+func (j *job) emit(t format.EventType, x *execution, detail string) {
+	if j.bus == nil { // without a daemon
+		return
+	}
+	name := j.name
+	e := &format.Event{Type: t.Enum(), Jobname: &name}
+	if x != nil {
+		if x.version != [20]byte{} {
+			version := x.Status(false).GetVersion()
+			e.Version = &version
+		}
+		if t == format.EventType_REFRESH_FINISHED || t == format.EventType_BUILD_FINISHED {
+			code := int32(x.errcode)
+			e.Errcode = &code
+		}
+	}
+	if detail != "" {
+		e.Detail = &detail
+	}
+	j.bus.publish(e)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"github.com/ericaro/ci/format"
+	"os/exec"
 	"time"
 )
 
@@ -23,9 +24,12 @@ func (x *execution) Marshal() *format.Execution { return x.Status(true) }
 // withResult true will also serialize the buffer's content.
 func (x *execution) Status(withResult bool) *format.Execution {
 	version := fmt.Sprintf("%x", x.version)
-	start, end := x.start.Unix(), x.end.Unix()
+	start, end := unix(x.start), unix(x.end)
 	code := int32(x.errcode)
-	result := x.result.String()
+	var result string
+	if x.result != nil { // never executed
+		result = x.result.String()
+	}
 	f := &format.Execution{
 		Version: &version,
 		Start:   &start,
@@ -39,7 +43,12 @@ func (x *execution) Status(withResult bool) *format.Execution {
 }
 
 //Unmarshal restore an execution instance from the format.Exception message.
+//
+// A nil message leaves the execution untouched (never executed).
 func (x *execution) Unmarshal(f *format.Execution) error {
+	if f == nil {
+		return nil
+	}
 
 	b, err := hex.DecodeString(f.GetVersion())
 	if err != nil {
@@ -50,11 +59,50 @@ func (x *execution) Unmarshal(f *format.Execution) error {
 	}
 	copy(x.version[:], b)
 
-	x.start = time.Unix(f.GetStart(), 0)
-	x.end = time.Unix(f.GetEnd(), 0)
+	x.start = fromUnix(f.GetStart())
+	x.end = fromUnix(f.GetEnd())
 
 	x.errcode = int(f.GetErrcode())
 	x.result = bytes.NewBufferString(f.GetResult())
 
+	if x.start.After(x.end) { // it was running when persisted, it will never finish.
+		x.end = x.start
+		x.errcode = int(format.ErrcodeInterrupted)
+	}
 	return nil
 }
+
+//unix returns the unix timestamp of 't', or 0 for a zero 't' (never executed)
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+//fromUnix is the reverse of unix()
+func fromUnix(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
+
+//errcode converts an execution error into an errcode: the process exit code if
+// there is one, or one of the format.Errcode*.
+func errcode(err error) int {
+	if err == errCancelled {
+		return int(format.ErrcodeCancelled)
+	}
+	switch e := err.(type) {
+	case *stageError:
+		return errcode(e.err)
+	case errTimedOut:
+		return int(format.ErrcodeTimedOut)
+	case *exec.ExitError:
+		if e.ExitCode() > 0 {
+			return e.ExitCode()
+		}
+	}
+	return int(format.ErrcodeFailed)
+}
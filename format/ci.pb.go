@@ -10,8 +10,12 @@ It is generated from these files:
 
 It has these top-level messages:
 	Jobid
+	Label
+	Variable
+	Secret
 	Job
 	Execution
+	Stage
 	Server
 	Request
 	Response
@@ -21,6 +25,36 @@ It has these top-level messages:
 	LogResponse
 	AddRequest
 	RemoveRequest
+	ApplyRequest
+	ApplyResponse
+	ExportRequest
+	ExportResponse
+	ImportRequest
+	ImportResponse
+	BuildRequest
+	CancelRequest
+	WaitRequest
+	WaitResponse
+	InfoRequest
+	InfoResponse
+	WatchRequest
+	WatchResponse
+	Event
+	EventsRequest
+	EventsResponse
+	Hook
+	Delivery
+	AddHookRequest
+	RemoveHookRequest
+	HooksRequest
+	HooksResponse
+	RedeliverRequest
+	RedeliverResponse
+	Credential
+	AddCredentialRequest
+	RemoveCredentialRequest
+	CredentialsRequest
+	CredentialsResponse
 */
 package format
 
@@ -31,11 +65,239 @@ import math "math"
 var _ = proto.Marshal
 var _ = math.Inf
 
+type JobStatus int32
+
+const (
+	JobStatus_NEVER_BUILT JobStatus = 0
+	JobStatus_QUEUED      JobStatus = 1
+	JobStatus_PULLING     JobStatus = 2
+	JobStatus_BUILDING    JobStatus = 3
+	JobStatus_SUCCESS     JobStatus = 4
+	JobStatus_FAILED      JobStatus = 5
+	JobStatus_CANCELLED   JobStatus = 6
+	JobStatus_TIMED_OUT   JobStatus = 7
+	JobStatus_INTERRUPTED JobStatus = 8
+	JobStatus_IDLE        JobStatus = 9
+)
+
+var JobStatus_name = map[int32]string{
+	0: "NEVER_BUILT",
+	1: "QUEUED",
+	2: "PULLING",
+	3: "BUILDING",
+	4: "SUCCESS",
+	5: "FAILED",
+	6: "CANCELLED",
+	7: "TIMED_OUT",
+	8: "INTERRUPTED",
+	9: "IDLE",
+}
+var JobStatus_value = map[string]int32{
+	"NEVER_BUILT": 0,
+	"QUEUED":      1,
+	"PULLING":     2,
+	"BUILDING":    3,
+	"SUCCESS":     4,
+	"FAILED":      5,
+	"CANCELLED":   6,
+	"TIMED_OUT":   7,
+	"INTERRUPTED": 8,
+	"IDLE":        9,
+}
+
+func (x JobStatus) Enum() *JobStatus {
+	p := new(JobStatus)
+	*p = x
+	return p
+}
+func (x JobStatus) String() string {
+	return proto.EnumName(JobStatus_name, int32(x))
+}
+func (x *JobStatus) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(JobStatus_value, data, "JobStatus")
+	if err != nil {
+		return err
+	}
+	*x = JobStatus(value)
+	return nil
+}
+
+type ErrorCode int32
+
+const (
+	ErrorCode_INTERNAL         ErrorCode = 0
+	ErrorCode_NOT_FOUND        ErrorCode = 1
+	ErrorCode_ALREADY_EXISTS   ErrorCode = 2
+	ErrorCode_INVALID_ARGUMENT ErrorCode = 3
+	ErrorCode_UNAUTHORIZED     ErrorCode = 4
+)
+
+var ErrorCode_name = map[int32]string{
+	0: "INTERNAL",
+	1: "NOT_FOUND",
+	2: "ALREADY_EXISTS",
+	3: "INVALID_ARGUMENT",
+	4: "UNAUTHORIZED",
+}
+var ErrorCode_value = map[string]int32{
+	"INTERNAL":         0,
+	"NOT_FOUND":        1,
+	"ALREADY_EXISTS":   2,
+	"INVALID_ARGUMENT": 3,
+	"UNAUTHORIZED":     4,
+}
+
+func (x ErrorCode) Enum() *ErrorCode {
+	p := new(ErrorCode)
+	*p = x
+	return p
+}
+func (x ErrorCode) String() string {
+	return proto.EnumName(ErrorCode_name, int32(x))
+}
+func (x *ErrorCode) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(ErrorCode_value, data, "ErrorCode")
+	if err != nil {
+		return err
+	}
+	*x = ErrorCode(value)
+	return nil
+}
+
+type EventType int32
+
+const (
+	EventType_JOB_SCHEDULED    EventType = 0
+	EventType_REFRESH_STARTED  EventType = 1
+	EventType_REFRESH_FINISHED EventType = 2
+	EventType_BUILD_STARTED    EventType = 3
+	EventType_BUILD_FINISHED   EventType = 4
+	EventType_BUILD_SKIPPED    EventType = 5
+	EventType_JOB_CANCELLED    EventType = 6
+	EventType_JOB_ADDED        EventType = 7
+	EventType_JOB_UPDATED      EventType = 8
+	EventType_JOB_REMOVED      EventType = 9
+)
+
+var EventType_name = map[int32]string{
+	0: "JOB_SCHEDULED",
+	1: "REFRESH_STARTED",
+	2: "REFRESH_FINISHED",
+	3: "BUILD_STARTED",
+	4: "BUILD_FINISHED",
+	5: "BUILD_SKIPPED",
+	6: "JOB_CANCELLED",
+	7: "JOB_ADDED",
+	8: "JOB_UPDATED",
+	9: "JOB_REMOVED",
+}
+var EventType_value = map[string]int32{
+	"JOB_SCHEDULED":    0,
+	"REFRESH_STARTED":  1,
+	"REFRESH_FINISHED": 2,
+	"BUILD_STARTED":    3,
+	"BUILD_FINISHED":   4,
+	"BUILD_SKIPPED":    5,
+	"JOB_CANCELLED":    6,
+	"JOB_ADDED":        7,
+	"JOB_UPDATED":      8,
+	"JOB_REMOVED":      9,
+}
+
+func (x EventType) Enum() *EventType {
+	p := new(EventType)
+	*p = x
+	return p
+}
+func (x EventType) String() string {
+	return proto.EnumName(EventType_name, int32(x))
+}
+func (x *EventType) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(EventType_value, data, "EventType")
+	if err != nil {
+		return err
+	}
+	*x = EventType(value)
+	return nil
+}
+
+type DeliveryState int32
+
+const (
+	DeliveryState_DELIVERY_PENDING   DeliveryState = 0
+	DeliveryState_DELIVERY_SUCCEEDED DeliveryState = 1
+	DeliveryState_DELIVERY_FAILED    DeliveryState = 2
+)
+
+var DeliveryState_name = map[int32]string{
+	0: "DELIVERY_PENDING",
+	1: "DELIVERY_SUCCEEDED",
+	2: "DELIVERY_FAILED",
+}
+var DeliveryState_value = map[string]int32{
+	"DELIVERY_PENDING":   0,
+	"DELIVERY_SUCCEEDED": 1,
+	"DELIVERY_FAILED":    2,
+}
+
+func (x DeliveryState) Enum() *DeliveryState {
+	p := new(DeliveryState)
+	*p = x
+	return p
+}
+func (x DeliveryState) String() string {
+	return proto.EnumName(DeliveryState_name, int32(x))
+}
+func (x *DeliveryState) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(DeliveryState_value, data, "DeliveryState")
+	if err != nil {
+		return err
+	}
+	*x = DeliveryState(value)
+	return nil
+}
+
+type CredentialKind int32
+
+const (
+	CredentialKind_SSH_KEY     CredentialKind = 0
+	CredentialKind_HTTPS_TOKEN CredentialKind = 1
+)
+
+var CredentialKind_name = map[int32]string{
+	0: "SSH_KEY",
+	1: "HTTPS_TOKEN",
+}
+var CredentialKind_value = map[string]int32{
+	"SSH_KEY":     0,
+	"HTTPS_TOKEN": 1,
+}
+
+func (x CredentialKind) Enum() *CredentialKind {
+	p := new(CredentialKind)
+	*p = x
+	return p
+}
+func (x CredentialKind) String() string {
+	return proto.EnumName(CredentialKind_name, int32(x))
+}
+func (x *CredentialKind) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(CredentialKind_value, data, "CredentialKind")
+	if err != nil {
+		return err
+	}
+	*x = CredentialKind(value)
+	return nil
+}
+
 type Jobid struct {
-	Name             *string `protobuf:"bytes,1,req,name=name" json:"name,omitempty"`
-	Remote           *string `protobuf:"bytes,2,req,name=remote" json:"remote,omitempty"`
-	Branch           *string `protobuf:"bytes,3,req,name=branch" json:"branch,omitempty"`
-	XXX_unrecognized []byte  `json:"-"`
+	Name             *string     `protobuf:"bytes,1,req,name=name" json:"name,omitempty"`
+	Remote           *string     `protobuf:"bytes,2,req,name=remote" json:"remote,omitempty"`
+	Branch           *string     `protobuf:"bytes,3,req,name=branch" json:"branch,omitempty"`
+	Labels           []*Label    `protobuf:"bytes,4,rep,name=labels" json:"labels,omitempty"`
+	Env              []*Variable `protobuf:"bytes,5,rep,name=env" json:"env,omitempty"`
+	Secrets          []*Secret   `protobuf:"bytes,6,rep,name=secrets" json:"secrets,omitempty"`
+	XXX_unrecognized []byte      `json:"-"`
 }
 
 func (m *Jobid) Reset()         { *m = Jobid{} }
@@ -63,6 +325,113 @@ func (m *Jobid) GetBranch() string {
 	return ""
 }
 
+func (m *Jobid) GetLabels() []*Label {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+func (m *Jobid) GetEnv() []*Variable {
+	if m != nil {
+		return m.Env
+	}
+	return nil
+}
+
+func (m *Jobid) GetSecrets() []*Secret {
+	if m != nil {
+		return m.Secrets
+	}
+	return nil
+}
+
+//
+//
+// ## label
+//
+// a key=value pair attached to a job, to filter jobs (see format.ParseLabels)
+//
+type Label struct {
+	Key              *string `protobuf:"bytes,1,req,name=key" json:"key,omitempty"`
+	Value            *string `protobuf:"bytes,2,req,name=value" json:"value,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *Label) Reset()         { *m = Label{} }
+func (m *Label) String() string { return proto.CompactTextString(m) }
+func (*Label) ProtoMessage()    {}
+
+func (m *Label) GetKey() string {
+	if m != nil && m.Key != nil {
+		return *m.Key
+	}
+	return ""
+}
+
+func (m *Label) GetValue() string {
+	if m != nil && m.Value != nil {
+		return *m.Value
+	}
+	return ""
+}
+
+type Variable struct {
+	Name             *string `protobuf:"bytes,1,req,name=name" json:"name,omitempty"`
+	Value            *string `protobuf:"bytes,2,req,name=value" json:"value,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *Variable) Reset()         { *m = Variable{} }
+func (m *Variable) String() string { return proto.CompactTextString(m) }
+func (*Variable) ProtoMessage()    {}
+
+func (m *Variable) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *Variable) GetValue() string {
+	if m != nil && m.Value != nil {
+		return *m.Value
+	}
+	return ""
+}
+
+type Secret struct {
+	Name             *string `protobuf:"bytes,1,req,name=name" json:"name,omitempty"`
+	Value            *string `protobuf:"bytes,2,opt,name=value" json:"value,omitempty"`
+	Sealed           []byte  `protobuf:"bytes,3,opt,name=sealed" json:"sealed,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *Secret) Reset()         { *m = Secret{} }
+func (m *Secret) String() string { return proto.CompactTextString(m) }
+func (*Secret) ProtoMessage()    {}
+
+func (m *Secret) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *Secret) GetValue() string {
+	if m != nil && m.Value != nil {
+		return *m.Value
+	}
+	return ""
+}
+
+func (m *Secret) GetSealed() []byte {
+	if m != nil {
+		return m.Sealed
+	}
+	return nil
+}
+
 //
 //
 // ## Job
@@ -70,10 +439,13 @@ func (m *Jobid) GetBranch() string {
 // a Job message contains the job identity, and information about the execution.
 //
 type Job struct {
-	Id               *Jobid     `protobuf:"bytes,1,req,name=id" json:"id,omitempty"`
-	Refresh          *Execution `protobuf:"bytes,4,req,name=refresh" json:"refresh,omitempty"`
-	Build            *Execution `protobuf:"bytes,5,req,name=build" json:"build,omitempty"`
-	XXX_unrecognized []byte     `json:"-"`
+	Id               *Jobid       `protobuf:"bytes,1,req,name=id" json:"id,omitempty"`
+	Refresh          *Execution   `protobuf:"bytes,4,opt,name=refresh" json:"refresh,omitempty"`
+	Build            *Execution   `protobuf:"bytes,5,opt,name=build" json:"build,omitempty"`
+	Stages           []*Stage     `protobuf:"bytes,6,rep,name=stages" json:"stages,omitempty"`
+	Status           *JobStatus   `protobuf:"varint,7,opt,name=status,enum=format.JobStatus" json:"status,omitempty"`
+	History          []*Execution `protobuf:"bytes,8,rep,name=history" json:"history,omitempty"`
+	XXX_unrecognized []byte       `json:"-"`
 }
 
 func (m *Job) Reset()         { *m = Job{} }
@@ -101,6 +473,27 @@ func (m *Job) GetBuild() *Execution {
 	return nil
 }
 
+func (m *Job) GetStages() []*Stage {
+	if m != nil {
+		return m.Stages
+	}
+	return nil
+}
+
+func (m *Job) GetStatus() JobStatus {
+	if m != nil && m.Status != nil {
+		return *m.Status
+	}
+	return JobStatus_NEVER_BUILT
+}
+
+func (m *Job) GetHistory() []*Execution {
+	if m != nil {
+		return m.History
+	}
+	return nil
+}
+
 //
 //
 // ## Execution
@@ -155,6 +548,45 @@ func (m *Execution) GetResult() string {
 	return ""
 }
 
+//
+//
+// ## Stage
+//
+// A build declared in a pipeline file (.ci.yml) is split into stages, each one
+// with its own execution.
+//
+type Stage struct {
+	Name             *string    `protobuf:"bytes,1,req,name=name" json:"name,omitempty"`
+	Execution        *Execution `protobuf:"bytes,2,req,name=execution" json:"execution,omitempty"`
+	AllowFailure     *bool      `protobuf:"varint,3,opt,name=allowFailure" json:"allowFailure,omitempty"`
+	XXX_unrecognized []byte     `json:"-"`
+}
+
+func (m *Stage) Reset()         { *m = Stage{} }
+func (m *Stage) String() string { return proto.CompactTextString(m) }
+func (*Stage) ProtoMessage()    {}
+
+func (m *Stage) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *Stage) GetExecution() *Execution {
+	if m != nil {
+		return m.Execution
+	}
+	return nil
+}
+
+func (m *Stage) GetAllowFailure() bool {
+	if m != nil && m.AllowFailure != nil {
+		return *m.AllowFailure
+	}
+	return false
+}
+
 //
 //
 // # persistence
@@ -162,8 +594,10 @@ func (m *Execution) GetResult() string {
 // the ciserver uses protobuf to persist data locally. It persists the "server" message.
 //
 type Server struct {
-	Jobs             []*Job `protobuf:"bytes,1,rep,name=jobs" json:"jobs,omitempty"`
-	XXX_unrecognized []byte `json:"-"`
+	Jobs             []*Job        `protobuf:"bytes,1,rep,name=jobs" json:"jobs,omitempty"`
+	Hooks            []*Hook       `protobuf:"bytes,2,rep,name=hooks" json:"hooks,omitempty"`
+	Credentials      []*Credential `protobuf:"bytes,3,rep,name=credentials" json:"credentials,omitempty"`
+	XXX_unrecognized []byte        `json:"-"`
 }
 
 func (m *Server) Reset()         { *m = Server{} }
@@ -177,6 +611,20 @@ func (m *Server) GetJobs() []*Job {
 	return nil
 }
 
+func (m *Server) GetHooks() []*Hook {
+	if m != nil {
+		return m.Hooks
+	}
+	return nil
+}
+
+func (m *Server) GetCredentials() []*Credential {
+	if m != nil {
+		return m.Credentials
+	}
+	return nil
+}
+
 //
 //
 // # protocol
@@ -187,11 +635,27 @@ func (m *Server) GetJobs() []*Job {
 // A specific application/x-protobuf mime type is used.
 //
 type Request struct {
-	List             *ListRequest   `protobuf:"bytes,2,opt,name=list" json:"list,omitempty"`
-	Log              *LogRequest    `protobuf:"bytes,3,opt,name=log" json:"log,omitempty"`
-	Add              *AddRequest    `protobuf:"bytes,4,opt,name=add" json:"add,omitempty"`
-	Remove           *RemoveRequest `protobuf:"bytes,5,opt,name=remove" json:"remove,omitempty"`
-	XXX_unrecognized []byte         `json:"-"`
+	List             *ListRequest             `protobuf:"bytes,2,opt,name=list" json:"list,omitempty"`
+	Log              *LogRequest              `protobuf:"bytes,3,opt,name=log" json:"log,omitempty"`
+	Add              *AddRequest              `protobuf:"bytes,4,opt,name=add" json:"add,omitempty"`
+	Remove           *RemoveRequest           `protobuf:"bytes,5,opt,name=remove" json:"remove,omitempty"`
+	Apply            *ApplyRequest            `protobuf:"bytes,6,opt,name=apply" json:"apply,omitempty"`
+	Export           *ExportRequest           `protobuf:"bytes,7,opt,name=export" json:"export,omitempty"`
+	Import           *ImportRequest           `protobuf:"bytes,8,opt,name=import" json:"import,omitempty"`
+	Build            *BuildRequest            `protobuf:"bytes,9,opt,name=build" json:"build,omitempty"`
+	Cancel           *CancelRequest           `protobuf:"bytes,10,opt,name=cancel" json:"cancel,omitempty"`
+	Wait             *WaitRequest             `protobuf:"bytes,11,opt,name=wait" json:"wait,omitempty"`
+	Info             *InfoRequest             `protobuf:"bytes,12,opt,name=info" json:"info,omitempty"`
+	Watch            *WatchRequest            `protobuf:"bytes,13,opt,name=watch" json:"watch,omitempty"`
+	Events           *EventsRequest           `protobuf:"bytes,14,opt,name=events" json:"events,omitempty"`
+	AddHook          *AddHookRequest          `protobuf:"bytes,15,opt,name=addHook" json:"addHook,omitempty"`
+	RemoveHook       *RemoveHookRequest       `protobuf:"bytes,16,opt,name=removeHook" json:"removeHook,omitempty"`
+	Hooks            *HooksRequest            `protobuf:"bytes,17,opt,name=hooks" json:"hooks,omitempty"`
+	Redeliver        *RedeliverRequest        `protobuf:"bytes,18,opt,name=redeliver" json:"redeliver,omitempty"`
+	AddCredential    *AddCredentialRequest    `protobuf:"bytes,19,opt,name=addCredential" json:"addCredential,omitempty"`
+	RemoveCredential *RemoveCredentialRequest `protobuf:"bytes,20,opt,name=removeCredential" json:"removeCredential,omitempty"`
+	Credentials      *CredentialsRequest      `protobuf:"bytes,21,opt,name=credentials" json:"credentials,omitempty"`
+	XXX_unrecognized []byte                   `json:"-"`
 }
 
 func (m *Request) Reset()         { *m = Request{} }
@@ -226,111 +690,327 @@ func (m *Request) GetRemove() *RemoveRequest {
 	return nil
 }
 
-type Response struct {
-	Error            *string       `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
-	List             *ListResponse `protobuf:"bytes,2,opt,name=list" json:"list,omitempty"`
-	Log              *LogResponse  `protobuf:"bytes,3,opt,name=log" json:"log,omitempty"`
-	XXX_unrecognized []byte        `json:"-"`
+func (m *Request) GetApply() *ApplyRequest {
+	if m != nil {
+		return m.Apply
+	}
+	return nil
 }
 
-func (m *Response) Reset()         { *m = Response{} }
-func (m *Response) String() string { return proto.CompactTextString(m) }
-func (*Response) ProtoMessage()    {}
-
-func (m *Response) GetError() string {
-	if m != nil && m.Error != nil {
-		return *m.Error
+func (m *Request) GetExport() *ExportRequest {
+	if m != nil {
+		return m.Export
 	}
-	return ""
+	return nil
 }
 
-func (m *Response) GetList() *ListResponse {
+func (m *Request) GetImport() *ImportRequest {
 	if m != nil {
-		return m.List
+		return m.Import
 	}
 	return nil
 }
 
-func (m *Response) GetLog() *LogResponse {
+func (m *Request) GetBuild() *BuildRequest {
 	if m != nil {
-		return m.Log
+		return m.Build
 	}
 	return nil
 }
 
-type ListRequest struct {
-	RefreshResult    *bool  `protobuf:"varint,1,opt,name=refreshResult" json:"refreshResult,omitempty"`
-	BuildResult      *bool  `protobuf:"varint,2,opt,name=buildResult" json:"buildResult,omitempty"`
-	XXX_unrecognized []byte `json:"-"`
+func (m *Request) GetCancel() *CancelRequest {
+	if m != nil {
+		return m.Cancel
+	}
+	return nil
 }
 
-func (m *ListRequest) Reset()         { *m = ListRequest{} }
-func (m *ListRequest) String() string { return proto.CompactTextString(m) }
-func (*ListRequest) ProtoMessage()    {}
-
-func (m *ListRequest) GetRefreshResult() bool {
-	if m != nil && m.RefreshResult != nil {
-		return *m.RefreshResult
+func (m *Request) GetWait() *WaitRequest {
+	if m != nil {
+		return m.Wait
 	}
-	return false
+	return nil
 }
 
-func (m *ListRequest) GetBuildResult() bool {
-	if m != nil && m.BuildResult != nil {
-		return *m.BuildResult
+func (m *Request) GetInfo() *InfoRequest {
+	if m != nil {
+		return m.Info
 	}
-	return false
+	return nil
 }
 
-type ListResponse struct {
-	Jobs             []*Job `protobuf:"bytes,1,rep,name=jobs" json:"jobs,omitempty"`
-	XXX_unrecognized []byte `json:"-"`
+func (m *Request) GetWatch() *WatchRequest {
+	if m != nil {
+		return m.Watch
+	}
+	return nil
 }
 
-func (m *ListResponse) Reset()         { *m = ListResponse{} }
-func (m *ListResponse) String() string { return proto.CompactTextString(m) }
-func (*ListResponse) ProtoMessage()    {}
-
-func (m *ListResponse) GetJobs() []*Job {
+func (m *Request) GetEvents() *EventsRequest {
 	if m != nil {
-		return m.Jobs
+		return m.Events
 	}
 	return nil
 }
 
-type LogRequest struct {
-	Jobname          *string `protobuf:"bytes,1,req,name=jobname" json:"jobname,omitempty"`
-	XXX_unrecognized []byte  `json:"-"`
+func (m *Request) GetAddHook() *AddHookRequest {
+	if m != nil {
+		return m.AddHook
+	}
+	return nil
 }
 
-func (m *LogRequest) Reset()         { *m = LogRequest{} }
-func (m *LogRequest) String() string { return proto.CompactTextString(m) }
-func (*LogRequest) ProtoMessage()    {}
-
-func (m *LogRequest) GetJobname() string {
-	if m != nil && m.Jobname != nil {
-		return *m.Jobname
+func (m *Request) GetRemoveHook() *RemoveHookRequest {
+	if m != nil {
+		return m.RemoveHook
 	}
-	return ""
+	return nil
 }
 
-type LogResponse struct {
-	Job              *Job   `protobuf:"bytes,1,req,name=job" json:"job,omitempty"`
-	XXX_unrecognized []byte `json:"-"`
+func (m *Request) GetHooks() *HooksRequest {
+	if m != nil {
+		return m.Hooks
+	}
+	return nil
 }
 
-func (m *LogResponse) Reset()         { *m = LogResponse{} }
-func (m *LogResponse) String() string { return proto.CompactTextString(m) }
-func (*LogResponse) ProtoMessage()    {}
-
-func (m *LogResponse) GetJob() *Job {
+func (m *Request) GetRedeliver() *RedeliverRequest {
 	if m != nil {
-		return m.Job
+		return m.Redeliver
 	}
 	return nil
 }
 
-type AddRequest struct {
+func (m *Request) GetAddCredential() *AddCredentialRequest {
+	if m != nil {
+		return m.AddCredential
+	}
+	return nil
+}
+
+func (m *Request) GetRemoveCredential() *RemoveCredentialRequest {
+	if m != nil {
+		return m.RemoveCredential
+	}
+	return nil
+}
+
+func (m *Request) GetCredentials() *CredentialsRequest {
+	if m != nil {
+		return m.Credentials
+	}
+	return nil
+}
+
+type Response struct {
+	Error            *string              `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+	List             *ListResponse        `protobuf:"bytes,2,opt,name=list" json:"list,omitempty"`
+	Log              *LogResponse         `protobuf:"bytes,3,opt,name=log" json:"log,omitempty"`
+	Apply            *ApplyResponse       `protobuf:"bytes,4,opt,name=apply" json:"apply,omitempty"`
+	Export           *ExportResponse      `protobuf:"bytes,5,opt,name=export" json:"export,omitempty"`
+	Import           *ImportResponse      `protobuf:"bytes,6,opt,name=import" json:"import,omitempty"`
+	Wait             *WaitResponse        `protobuf:"bytes,7,opt,name=wait" json:"wait,omitempty"`
+	Code             *ErrorCode           `protobuf:"varint,8,opt,name=code,enum=format.ErrorCode" json:"code,omitempty"`
+	Info             *InfoResponse        `protobuf:"bytes,9,opt,name=info" json:"info,omitempty"`
+	Watch            *WatchResponse       `protobuf:"bytes,10,opt,name=watch" json:"watch,omitempty"`
+	Events           *EventsResponse      `protobuf:"bytes,11,opt,name=events" json:"events,omitempty"`
+	Hooks            *HooksResponse       `protobuf:"bytes,12,opt,name=hooks" json:"hooks,omitempty"`
+	Redeliver        *RedeliverResponse   `protobuf:"bytes,13,opt,name=redeliver" json:"redeliver,omitempty"`
+	Credentials      *CredentialsResponse `protobuf:"bytes,14,opt,name=credentials" json:"credentials,omitempty"`
+	XXX_unrecognized []byte               `json:"-"`
+}
+
+func (m *Response) Reset()         { *m = Response{} }
+func (m *Response) String() string { return proto.CompactTextString(m) }
+func (*Response) ProtoMessage()    {}
+
+func (m *Response) GetError() string {
+	if m != nil && m.Error != nil {
+		return *m.Error
+	}
+	return ""
+}
+
+func (m *Response) GetList() *ListResponse {
+	if m != nil {
+		return m.List
+	}
+	return nil
+}
+
+func (m *Response) GetLog() *LogResponse {
+	if m != nil {
+		return m.Log
+	}
+	return nil
+}
+
+func (m *Response) GetApply() *ApplyResponse {
+	if m != nil {
+		return m.Apply
+	}
+	return nil
+}
+
+func (m *Response) GetExport() *ExportResponse {
+	if m != nil {
+		return m.Export
+	}
+	return nil
+}
+
+func (m *Response) GetImport() *ImportResponse {
+	if m != nil {
+		return m.Import
+	}
+	return nil
+}
+
+func (m *Response) GetWait() *WaitResponse {
+	if m != nil {
+		return m.Wait
+	}
+	return nil
+}
+
+func (m *Response) GetCode() ErrorCode {
+	if m != nil && m.Code != nil {
+		return *m.Code
+	}
+	return ErrorCode_INTERNAL
+}
+
+func (m *Response) GetInfo() *InfoResponse {
+	if m != nil {
+		return m.Info
+	}
+	return nil
+}
+
+func (m *Response) GetWatch() *WatchResponse {
+	if m != nil {
+		return m.Watch
+	}
+	return nil
+}
+
+func (m *Response) GetEvents() *EventsResponse {
+	if m != nil {
+		return m.Events
+	}
+	return nil
+}
+
+func (m *Response) GetHooks() *HooksResponse {
+	if m != nil {
+		return m.Hooks
+	}
+	return nil
+}
+
+func (m *Response) GetRedeliver() *RedeliverResponse {
+	if m != nil {
+		return m.Redeliver
+	}
+	return nil
+}
+
+func (m *Response) GetCredentials() *CredentialsResponse {
+	if m != nil {
+		return m.Credentials
+	}
+	return nil
+}
+
+type ListRequest struct {
+	RefreshResult    *bool    `protobuf:"varint,1,opt,name=refreshResult" json:"refreshResult,omitempty"`
+	BuildResult      *bool    `protobuf:"varint,2,opt,name=buildResult" json:"buildResult,omitempty"`
+	History          *bool    `protobuf:"varint,3,opt,name=history" json:"history,omitempty"`
+	Selector         []*Label `protobuf:"bytes,4,rep,name=selector" json:"selector,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *ListRequest) Reset()         { *m = ListRequest{} }
+func (m *ListRequest) String() string { return proto.CompactTextString(m) }
+func (*ListRequest) ProtoMessage()    {}
+
+func (m *ListRequest) GetRefreshResult() bool {
+	if m != nil && m.RefreshResult != nil {
+		return *m.RefreshResult
+	}
+	return false
+}
+
+func (m *ListRequest) GetBuildResult() bool {
+	if m != nil && m.BuildResult != nil {
+		return *m.BuildResult
+	}
+	return false
+}
+
+func (m *ListRequest) GetHistory() bool {
+	if m != nil && m.History != nil {
+		return *m.History
+	}
+	return false
+}
+
+func (m *ListRequest) GetSelector() []*Label {
+	if m != nil {
+		return m.Selector
+	}
+	return nil
+}
+
+type ListResponse struct {
+	Jobs             []*Job `protobuf:"bytes,1,rep,name=jobs" json:"jobs,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *ListResponse) Reset()         { *m = ListResponse{} }
+func (m *ListResponse) String() string { return proto.CompactTextString(m) }
+func (*ListResponse) ProtoMessage()    {}
+
+func (m *ListResponse) GetJobs() []*Job {
+	if m != nil {
+		return m.Jobs
+	}
+	return nil
+}
+
+type LogRequest struct {
+	Jobname          *string `protobuf:"bytes,1,req,name=jobname" json:"jobname,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *LogRequest) Reset()         { *m = LogRequest{} }
+func (m *LogRequest) String() string { return proto.CompactTextString(m) }
+func (*LogRequest) ProtoMessage()    {}
+
+func (m *LogRequest) GetJobname() string {
+	if m != nil && m.Jobname != nil {
+		return *m.Jobname
+	}
+	return ""
+}
+
+type LogResponse struct {
+	Job              *Job   `protobuf:"bytes,1,req,name=job" json:"job,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *LogResponse) Reset()         { *m = LogResponse{} }
+func (m *LogResponse) String() string { return proto.CompactTextString(m) }
+func (*LogResponse) ProtoMessage()    {}
+
+func (m *LogResponse) GetJob() *Job {
+	if m != nil {
+		return m.Job
+	}
+	return nil
+}
+
+type AddRequest struct {
 	Id               *Jobid `protobuf:"bytes,1,req,name=id" json:"id,omitempty"`
 	XXX_unrecognized []byte `json:"-"`
 }
@@ -362,5 +1042,930 @@ func (m *RemoveRequest) GetJobname() string {
 	return ""
 }
 
+//
+//
+// ## apply
+//
+// reconcile the daemon's jobs with a declarative list of jobs (see format.JobFile).
+//
+type ApplyRequest struct {
+	Jobs             []*Jobid `protobuf:"bytes,1,rep,name=jobs" json:"jobs,omitempty"`
+	Prune            *bool    `protobuf:"varint,2,opt,name=prune" json:"prune,omitempty"`
+	Dryrun           *bool    `protobuf:"varint,3,opt,name=dryrun" json:"dryrun,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *ApplyRequest) Reset()         { *m = ApplyRequest{} }
+func (m *ApplyRequest) String() string { return proto.CompactTextString(m) }
+func (*ApplyRequest) ProtoMessage()    {}
+
+func (m *ApplyRequest) GetJobs() []*Jobid {
+	if m != nil {
+		return m.Jobs
+	}
+	return nil
+}
+
+func (m *ApplyRequest) GetPrune() bool {
+	if m != nil && m.Prune != nil {
+		return *m.Prune
+	}
+	return false
+}
+
+func (m *ApplyRequest) GetDryrun() bool {
+	if m != nil && m.Dryrun != nil {
+		return *m.Dryrun
+	}
+	return false
+}
+
+type ApplyResponse struct {
+	Added            []string `protobuf:"bytes,1,rep,name=added" json:"added,omitempty"`
+	Updated          []string `protobuf:"bytes,2,rep,name=updated" json:"updated,omitempty"`
+	Removed          []string `protobuf:"bytes,3,rep,name=removed" json:"removed,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *ApplyResponse) Reset()         { *m = ApplyResponse{} }
+func (m *ApplyResponse) String() string { return proto.CompactTextString(m) }
+func (*ApplyResponse) ProtoMessage()    {}
+
+func (m *ApplyResponse) GetAdded() []string {
+	if m != nil {
+		return m.Added
+	}
+	return nil
+}
+
+func (m *ApplyResponse) GetUpdated() []string {
+	if m != nil {
+		return m.Updated
+	}
+	return nil
+}
+
+func (m *ApplyResponse) GetRemoved() []string {
+	if m != nil {
+		return m.Removed
+	}
+	return nil
+}
+
+//
+//
+// ## export/import
+//
+// move job definitions, and optionally their history, from one daemon to another.
+//
+type ExportRequest struct {
+	History          *bool  `protobuf:"varint,1,opt,name=history" json:"history,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *ExportRequest) Reset()         { *m = ExportRequest{} }
+func (m *ExportRequest) String() string { return proto.CompactTextString(m) }
+func (*ExportRequest) ProtoMessage()    {}
+
+func (m *ExportRequest) GetHistory() bool {
+	if m != nil && m.History != nil {
+		return *m.History
+	}
+	return false
+}
+
+type ExportResponse struct {
+	Jobs             []*Job `protobuf:"bytes,1,rep,name=jobs" json:"jobs,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *ExportResponse) Reset()         { *m = ExportResponse{} }
+func (m *ExportResponse) String() string { return proto.CompactTextString(m) }
+func (*ExportResponse) ProtoMessage()    {}
+
+func (m *ExportResponse) GetJobs() []*Job {
+	if m != nil {
+		return m.Jobs
+	}
+	return nil
+}
+
+type ImportRequest struct {
+	Jobs             []*Job `protobuf:"bytes,1,rep,name=jobs" json:"jobs,omitempty"`
+	Overwrite        *bool  `protobuf:"varint,2,opt,name=overwrite" json:"overwrite,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *ImportRequest) Reset()         { *m = ImportRequest{} }
+func (m *ImportRequest) String() string { return proto.CompactTextString(m) }
+func (*ImportRequest) ProtoMessage()    {}
+
+func (m *ImportRequest) GetJobs() []*Job {
+	if m != nil {
+		return m.Jobs
+	}
+	return nil
+}
+
+func (m *ImportRequest) GetOverwrite() bool {
+	if m != nil && m.Overwrite != nil {
+		return *m.Overwrite
+	}
+	return false
+}
+
+type ImportResponse struct {
+	Imported         []string `protobuf:"bytes,1,rep,name=imported" json:"imported,omitempty"`
+	Skipped          []string `protobuf:"bytes,2,rep,name=skipped" json:"skipped,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *ImportResponse) Reset()         { *m = ImportResponse{} }
+func (m *ImportResponse) String() string { return proto.CompactTextString(m) }
+func (*ImportResponse) ProtoMessage()    {}
+
+func (m *ImportResponse) GetImported() []string {
+	if m != nil {
+		return m.Imported
+	}
+	return nil
+}
+
+func (m *ImportResponse) GetSkipped() []string {
+	if m != nil {
+		return m.Skipped
+	}
+	return nil
+}
+
+//
+//
+// ## build/cancel
+//
+// act on a single job: run it now, or stop its ongoing (or scheduled) run.
+//
+type BuildRequest struct {
+	Jobname          *string `protobuf:"bytes,1,req,name=jobname" json:"jobname,omitempty"`
+	Force            *bool   `protobuf:"varint,2,opt,name=force" json:"force,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *BuildRequest) Reset()         { *m = BuildRequest{} }
+func (m *BuildRequest) String() string { return proto.CompactTextString(m) }
+func (*BuildRequest) ProtoMessage()    {}
+
+func (m *BuildRequest) GetJobname() string {
+	if m != nil && m.Jobname != nil {
+		return *m.Jobname
+	}
+	return ""
+}
+
+func (m *BuildRequest) GetForce() bool {
+	if m != nil && m.Force != nil {
+		return *m.Force
+	}
+	return false
+}
+
+type CancelRequest struct {
+	Jobname          *string `protobuf:"bytes,1,req,name=jobname" json:"jobname,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *CancelRequest) Reset()         { *m = CancelRequest{} }
+func (m *CancelRequest) String() string { return proto.CompactTextString(m) }
+func (*CancelRequest) ProtoMessage()    {}
+
+func (m *CancelRequest) GetJobname() string {
+	if m != nil && m.Jobname != nil {
+		return *m.Jobname
+	}
+	return ""
+}
+
+//
+//
+// ## wait
+//
+// a long-poll: the daemon answers when the job is done, or when the timeout expires.
+//
+type WaitRequest struct {
+	Jobname          *string `protobuf:"bytes,1,req,name=jobname" json:"jobname,omitempty"`
+	Version          *string `protobuf:"bytes,2,opt,name=version" json:"version,omitempty"`
+	Timeout          *int64  `protobuf:"varint,3,opt,name=timeout" json:"timeout,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *WaitRequest) Reset()         { *m = WaitRequest{} }
+func (m *WaitRequest) String() string { return proto.CompactTextString(m) }
+func (*WaitRequest) ProtoMessage()    {}
+
+func (m *WaitRequest) GetJobname() string {
+	if m != nil && m.Jobname != nil {
+		return *m.Jobname
+	}
+	return ""
+}
+
+func (m *WaitRequest) GetVersion() string {
+	if m != nil && m.Version != nil {
+		return *m.Version
+	}
+	return ""
+}
+
+func (m *WaitRequest) GetTimeout() int64 {
+	if m != nil && m.Timeout != nil {
+		return *m.Timeout
+	}
+	return 0
+}
+
+type WaitResponse struct {
+	Job              *Job   `protobuf:"bytes,1,req,name=job" json:"job,omitempty"`
+	Done             *bool  `protobuf:"varint,2,opt,name=done" json:"done,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *WaitResponse) Reset()         { *m = WaitResponse{} }
+func (m *WaitResponse) String() string { return proto.CompactTextString(m) }
+func (*WaitResponse) ProtoMessage()    {}
+
+func (m *WaitResponse) GetJob() *Job {
+	if m != nil {
+		return m.Job
+	}
+	return nil
+}
+
+func (m *WaitResponse) GetDone() bool {
+	if m != nil && m.Done != nil {
+		return *m.Done
+	}
+	return false
+}
+
+type InfoRequest struct {
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *InfoRequest) Reset()         { *m = InfoRequest{} }
+func (m *InfoRequest) String() string { return proto.CompactTextString(m) }
+func (*InfoRequest) ProtoMessage()    {}
+
+type InfoResponse struct {
+	Version          *string  `protobuf:"bytes,1,req,name=version" json:"version,omitempty"`
+	Protocol         *int32   `protobuf:"varint,2,req,name=protocol" json:"protocol,omitempty"`
+	Features         []string `protobuf:"bytes,3,rep,name=features" json:"features,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *InfoResponse) Reset()         { *m = InfoResponse{} }
+func (m *InfoResponse) String() string { return proto.CompactTextString(m) }
+func (*InfoResponse) ProtoMessage()    {}
+
+func (m *InfoResponse) GetVersion() string {
+	if m != nil && m.Version != nil {
+		return *m.Version
+	}
+	return ""
+}
+
+func (m *InfoResponse) GetProtocol() int32 {
+	if m != nil && m.Protocol != nil {
+		return *m.Protocol
+	}
+	return 0
+}
+
+func (m *InfoResponse) GetFeatures() []string {
+	if m != nil {
+		return m.Features
+	}
+	return nil
+}
+
+type WatchRequest struct {
+	Revision         *uint64  `protobuf:"varint,1,opt,name=revision" json:"revision,omitempty"`
+	Timeout          *int64   `protobuf:"varint,2,opt,name=timeout" json:"timeout,omitempty"`
+	Jobname          *string  `protobuf:"bytes,3,opt,name=jobname" json:"jobname,omitempty"`
+	Selector         []*Label `protobuf:"bytes,4,rep,name=selector" json:"selector,omitempty"`
+	RefreshResult    *bool    `protobuf:"varint,5,opt,name=refreshResult" json:"refreshResult,omitempty"`
+	BuildResult      *bool    `protobuf:"varint,6,opt,name=buildResult" json:"buildResult,omitempty"`
+	History          *bool    `protobuf:"varint,7,opt,name=history" json:"history,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *WatchRequest) Reset()         { *m = WatchRequest{} }
+func (m *WatchRequest) String() string { return proto.CompactTextString(m) }
+func (*WatchRequest) ProtoMessage()    {}
+
+func (m *WatchRequest) GetRevision() uint64 {
+	if m != nil && m.Revision != nil {
+		return *m.Revision
+	}
+	return 0
+}
+
+func (m *WatchRequest) GetTimeout() int64 {
+	if m != nil && m.Timeout != nil {
+		return *m.Timeout
+	}
+	return 0
+}
+
+func (m *WatchRequest) GetJobname() string {
+	if m != nil && m.Jobname != nil {
+		return *m.Jobname
+	}
+	return ""
+}
+
+func (m *WatchRequest) GetSelector() []*Label {
+	if m != nil {
+		return m.Selector
+	}
+	return nil
+}
+
+func (m *WatchRequest) GetRefreshResult() bool {
+	if m != nil && m.RefreshResult != nil {
+		return *m.RefreshResult
+	}
+	return false
+}
+
+func (m *WatchRequest) GetBuildResult() bool {
+	if m != nil && m.BuildResult != nil {
+		return *m.BuildResult
+	}
+	return false
+}
+
+func (m *WatchRequest) GetHistory() bool {
+	if m != nil && m.History != nil {
+		return *m.History
+	}
+	return false
+}
+
+type WatchResponse struct {
+	Revision         *uint64  `protobuf:"varint,1,req,name=revision" json:"revision,omitempty"`
+	Jobs             []*Job   `protobuf:"bytes,2,rep,name=jobs" json:"jobs,omitempty"`
+	Removed          []string `protobuf:"bytes,3,rep,name=removed" json:"removed,omitempty"`
+	Full             *bool    `protobuf:"varint,4,opt,name=full" json:"full,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *WatchResponse) Reset()         { *m = WatchResponse{} }
+func (m *WatchResponse) String() string { return proto.CompactTextString(m) }
+func (*WatchResponse) ProtoMessage()    {}
+
+func (m *WatchResponse) GetRevision() uint64 {
+	if m != nil && m.Revision != nil {
+		return *m.Revision
+	}
+	return 0
+}
+
+func (m *WatchResponse) GetJobs() []*Job {
+	if m != nil {
+		return m.Jobs
+	}
+	return nil
+}
+
+func (m *WatchResponse) GetRemoved() []string {
+	if m != nil {
+		return m.Removed
+	}
+	return nil
+}
+
+func (m *WatchResponse) GetFull() bool {
+	if m != nil && m.Full != nil {
+		return *m.Full
+	}
+	return false
+}
+
+type Event struct {
+	Id               *int64     `protobuf:"varint,1,req,name=id" json:"id,omitempty"`
+	Time             *int64     `protobuf:"varint,2,req,name=time" json:"time,omitempty"`
+	Type             *EventType `protobuf:"varint,3,req,name=type,enum=format.EventType" json:"type,omitempty"`
+	Jobname          *string    `protobuf:"bytes,4,req,name=jobname" json:"jobname,omitempty"`
+	Version          *string    `protobuf:"bytes,5,opt,name=version" json:"version,omitempty"`
+	Errcode          *int32     `protobuf:"varint,6,opt,name=errcode" json:"errcode,omitempty"`
+	Detail           *string    `protobuf:"bytes,7,opt,name=detail" json:"detail,omitempty"`
+	XXX_unrecognized []byte     `json:"-"`
+}
+
+func (m *Event) Reset()         { *m = Event{} }
+func (m *Event) String() string { return proto.CompactTextString(m) }
+func (*Event) ProtoMessage()    {}
+
+func (m *Event) GetId() int64 {
+	if m != nil && m.Id != nil {
+		return *m.Id
+	}
+	return 0
+}
+
+func (m *Event) GetTime() int64 {
+	if m != nil && m.Time != nil {
+		return *m.Time
+	}
+	return 0
+}
+
+func (m *Event) GetType() EventType {
+	if m != nil && m.Type != nil {
+		return *m.Type
+	}
+	return EventType_JOB_SCHEDULED
+}
+
+func (m *Event) GetJobname() string {
+	if m != nil && m.Jobname != nil {
+		return *m.Jobname
+	}
+	return ""
+}
+
+func (m *Event) GetVersion() string {
+	if m != nil && m.Version != nil {
+		return *m.Version
+	}
+	return ""
+}
+
+func (m *Event) GetErrcode() int32 {
+	if m != nil && m.Errcode != nil {
+		return *m.Errcode
+	}
+	return 0
+}
+
+func (m *Event) GetDetail() string {
+	if m != nil && m.Detail != nil {
+		return *m.Detail
+	}
+	return ""
+}
+
+type EventsRequest struct {
+	Since            *int64  `protobuf:"varint,1,opt,name=since" json:"since,omitempty"`
+	Jobname          *string `protobuf:"bytes,2,opt,name=jobname" json:"jobname,omitempty"`
+	Limit            *int32  `protobuf:"varint,3,opt,name=limit" json:"limit,omitempty"`
+	Timeout          *int64  `protobuf:"varint,4,opt,name=timeout" json:"timeout,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *EventsRequest) Reset()         { *m = EventsRequest{} }
+func (m *EventsRequest) String() string { return proto.CompactTextString(m) }
+func (*EventsRequest) ProtoMessage()    {}
+
+func (m *EventsRequest) GetSince() int64 {
+	if m != nil && m.Since != nil {
+		return *m.Since
+	}
+	return 0
+}
+
+func (m *EventsRequest) GetJobname() string {
+	if m != nil && m.Jobname != nil {
+		return *m.Jobname
+	}
+	return ""
+}
+
+func (m *EventsRequest) GetLimit() int32 {
+	if m != nil && m.Limit != nil {
+		return *m.Limit
+	}
+	return 0
+}
+
+func (m *EventsRequest) GetTimeout() int64 {
+	if m != nil && m.Timeout != nil {
+		return *m.Timeout
+	}
+	return 0
+}
+
+type EventsResponse struct {
+	Events           []*Event `protobuf:"bytes,1,rep,name=events" json:"events,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *EventsResponse) Reset()         { *m = EventsResponse{} }
+func (m *EventsResponse) String() string { return proto.CompactTextString(m) }
+func (*EventsResponse) ProtoMessage()    {}
+
+func (m *EventsResponse) GetEvents() []*Event {
+	if m != nil {
+		return m.Events
+	}
+	return nil
+}
+
+type Hook struct {
+	Name             *string     `protobuf:"bytes,1,req,name=name" json:"name,omitempty"`
+	Url              *string     `protobuf:"bytes,2,req,name=url" json:"url,omitempty"`
+	Jobname          *string     `protobuf:"bytes,3,opt,name=jobname" json:"jobname,omitempty"`
+	Events           []EventType `protobuf:"varint,4,rep,name=events,enum=format.EventType" json:"events,omitempty"`
+	Secret           *string     `protobuf:"bytes,5,opt,name=secret" json:"secret,omitempty"`
+	Signed           *bool       `protobuf:"varint,6,opt,name=signed" json:"signed,omitempty"`
+	Sealed           []byte      `protobuf:"bytes,7,opt,name=sealed" json:"sealed,omitempty"`
+	XXX_unrecognized []byte      `json:"-"`
+}
+
+func (m *Hook) Reset()         { *m = Hook{} }
+func (m *Hook) String() string { return proto.CompactTextString(m) }
+func (*Hook) ProtoMessage()    {}
+
+func (m *Hook) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *Hook) GetUrl() string {
+	if m != nil && m.Url != nil {
+		return *m.Url
+	}
+	return ""
+}
+
+func (m *Hook) GetJobname() string {
+	if m != nil && m.Jobname != nil {
+		return *m.Jobname
+	}
+	return ""
+}
+
+func (m *Hook) GetEvents() []EventType {
+	if m != nil {
+		return m.Events
+	}
+	return nil
+}
+
+func (m *Hook) GetSecret() string {
+	if m != nil && m.Secret != nil {
+		return *m.Secret
+	}
+	return ""
+}
+
+func (m *Hook) GetSigned() bool {
+	if m != nil && m.Signed != nil {
+		return *m.Signed
+	}
+	return false
+}
+
+func (m *Hook) GetSealed() []byte {
+	if m != nil {
+		return m.Sealed
+	}
+	return nil
+}
+
+type Delivery struct {
+	Id               *int64         `protobuf:"varint,1,req,name=id" json:"id,omitempty"`
+	Hook             *string        `protobuf:"bytes,2,req,name=hook" json:"hook,omitempty"`
+	Event            *Event         `protobuf:"bytes,3,req,name=event" json:"event,omitempty"`
+	State            *DeliveryState `protobuf:"varint,4,opt,name=state,enum=format.DeliveryState" json:"state,omitempty"`
+	Attempts         *int32         `protobuf:"varint,5,opt,name=attempts" json:"attempts,omitempty"`
+	Status           *int32         `protobuf:"varint,6,opt,name=status" json:"status,omitempty"`
+	Error            *string        `protobuf:"bytes,7,opt,name=error" json:"error,omitempty"`
+	Time             *int64         `protobuf:"varint,8,opt,name=time" json:"time,omitempty"`
+	Payload          *string        `protobuf:"bytes,9,opt,name=payload" json:"payload,omitempty"`
+	Redelivery       *int64         `protobuf:"varint,10,opt,name=redelivery" json:"redelivery,omitempty"`
+	XXX_unrecognized []byte         `json:"-"`
+}
+
+func (m *Delivery) Reset()         { *m = Delivery{} }
+func (m *Delivery) String() string { return proto.CompactTextString(m) }
+func (*Delivery) ProtoMessage()    {}
+
+func (m *Delivery) GetId() int64 {
+	if m != nil && m.Id != nil {
+		return *m.Id
+	}
+	return 0
+}
+
+func (m *Delivery) GetHook() string {
+	if m != nil && m.Hook != nil {
+		return *m.Hook
+	}
+	return ""
+}
+
+func (m *Delivery) GetEvent() *Event {
+	if m != nil {
+		return m.Event
+	}
+	return nil
+}
+
+func (m *Delivery) GetState() DeliveryState {
+	if m != nil && m.State != nil {
+		return *m.State
+	}
+	return DeliveryState_DELIVERY_PENDING
+}
+
+func (m *Delivery) GetAttempts() int32 {
+	if m != nil && m.Attempts != nil {
+		return *m.Attempts
+	}
+	return 0
+}
+
+func (m *Delivery) GetStatus() int32 {
+	if m != nil && m.Status != nil {
+		return *m.Status
+	}
+	return 0
+}
+
+func (m *Delivery) GetError() string {
+	if m != nil && m.Error != nil {
+		return *m.Error
+	}
+	return ""
+}
+
+func (m *Delivery) GetTime() int64 {
+	if m != nil && m.Time != nil {
+		return *m.Time
+	}
+	return 0
+}
+
+func (m *Delivery) GetPayload() string {
+	if m != nil && m.Payload != nil {
+		return *m.Payload
+	}
+	return ""
+}
+
+func (m *Delivery) GetRedelivery() int64 {
+	if m != nil && m.Redelivery != nil {
+		return *m.Redelivery
+	}
+	return 0
+}
+
+type AddHookRequest struct {
+	Hook             *Hook  `protobuf:"bytes,1,req,name=hook" json:"hook,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *AddHookRequest) Reset()         { *m = AddHookRequest{} }
+func (m *AddHookRequest) String() string { return proto.CompactTextString(m) }
+func (*AddHookRequest) ProtoMessage()    {}
+
+func (m *AddHookRequest) GetHook() *Hook {
+	if m != nil {
+		return m.Hook
+	}
+	return nil
+}
+
+type RemoveHookRequest struct {
+	Name             *string `protobuf:"bytes,1,req,name=name" json:"name,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *RemoveHookRequest) Reset()         { *m = RemoveHookRequest{} }
+func (m *RemoveHookRequest) String() string { return proto.CompactTextString(m) }
+func (*RemoveHookRequest) ProtoMessage()    {}
+
+func (m *RemoveHookRequest) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+type HooksRequest struct {
+	Hook             *string `protobuf:"bytes,1,opt,name=hook" json:"hook,omitempty"`
+	Failed           *bool   `protobuf:"varint,2,opt,name=failed" json:"failed,omitempty"`
+	Limit            *int32  `protobuf:"varint,3,opt,name=limit" json:"limit,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *HooksRequest) Reset()         { *m = HooksRequest{} }
+func (m *HooksRequest) String() string { return proto.CompactTextString(m) }
+func (*HooksRequest) ProtoMessage()    {}
+
+func (m *HooksRequest) GetHook() string {
+	if m != nil && m.Hook != nil {
+		return *m.Hook
+	}
+	return ""
+}
+
+func (m *HooksRequest) GetFailed() bool {
+	if m != nil && m.Failed != nil {
+		return *m.Failed
+	}
+	return false
+}
+
+func (m *HooksRequest) GetLimit() int32 {
+	if m != nil && m.Limit != nil {
+		return *m.Limit
+	}
+	return 0
+}
+
+type HooksResponse struct {
+	Hooks            []*Hook     `protobuf:"bytes,1,rep,name=hooks" json:"hooks,omitempty"`
+	Deliveries       []*Delivery `protobuf:"bytes,2,rep,name=deliveries" json:"deliveries,omitempty"`
+	XXX_unrecognized []byte      `json:"-"`
+}
+
+func (m *HooksResponse) Reset()         { *m = HooksResponse{} }
+func (m *HooksResponse) String() string { return proto.CompactTextString(m) }
+func (*HooksResponse) ProtoMessage()    {}
+
+func (m *HooksResponse) GetHooks() []*Hook {
+	if m != nil {
+		return m.Hooks
+	}
+	return nil
+}
+
+func (m *HooksResponse) GetDeliveries() []*Delivery {
+	if m != nil {
+		return m.Deliveries
+	}
+	return nil
+}
+
+type RedeliverRequest struct {
+	Delivery         *int64 `protobuf:"varint,1,req,name=delivery" json:"delivery,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *RedeliverRequest) Reset()         { *m = RedeliverRequest{} }
+func (m *RedeliverRequest) String() string { return proto.CompactTextString(m) }
+func (*RedeliverRequest) ProtoMessage()    {}
+
+func (m *RedeliverRequest) GetDelivery() int64 {
+	if m != nil && m.Delivery != nil {
+		return *m.Delivery
+	}
+	return 0
+}
+
+type RedeliverResponse struct {
+	Delivery         *Delivery `protobuf:"bytes,1,opt,name=delivery" json:"delivery,omitempty"`
+	XXX_unrecognized []byte    `json:"-"`
+}
+
+func (m *RedeliverResponse) Reset()         { *m = RedeliverResponse{} }
+func (m *RedeliverResponse) String() string { return proto.CompactTextString(m) }
+func (*RedeliverResponse) ProtoMessage()    {}
+
+func (m *RedeliverResponse) GetDelivery() *Delivery {
+	if m != nil {
+		return m.Delivery
+	}
+	return nil
+}
+
+type Credential struct {
+	Name             *string         `protobuf:"bytes,1,req,name=name" json:"name,omitempty"`
+	Kind             *CredentialKind `protobuf:"varint,2,opt,name=kind,enum=format.CredentialKind" json:"kind,omitempty"`
+	Host             *string         `protobuf:"bytes,3,opt,name=host" json:"host,omitempty"`
+	Jobname          *string         `protobuf:"bytes,4,opt,name=jobname" json:"jobname,omitempty"`
+	Username         *string         `protobuf:"bytes,5,opt,name=username" json:"username,omitempty"`
+	Secret           *string         `protobuf:"bytes,6,opt,name=secret" json:"secret,omitempty"`
+	Sealed           []byte          `protobuf:"bytes,7,opt,name=sealed" json:"sealed,omitempty"`
+	XXX_unrecognized []byte          `json:"-"`
+}
+
+func (m *Credential) Reset()         { *m = Credential{} }
+func (m *Credential) String() string { return proto.CompactTextString(m) }
+func (*Credential) ProtoMessage()    {}
+
+func (m *Credential) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *Credential) GetKind() CredentialKind {
+	if m != nil && m.Kind != nil {
+		return *m.Kind
+	}
+	return CredentialKind_SSH_KEY
+}
+
+func (m *Credential) GetHost() string {
+	if m != nil && m.Host != nil {
+		return *m.Host
+	}
+	return ""
+}
+
+func (m *Credential) GetJobname() string {
+	if m != nil && m.Jobname != nil {
+		return *m.Jobname
+	}
+	return ""
+}
+
+func (m *Credential) GetUsername() string {
+	if m != nil && m.Username != nil {
+		return *m.Username
+	}
+	return ""
+}
+
+func (m *Credential) GetSecret() string {
+	if m != nil && m.Secret != nil {
+		return *m.Secret
+	}
+	return ""
+}
+
+func (m *Credential) GetSealed() []byte {
+	if m != nil {
+		return m.Sealed
+	}
+	return nil
+}
+
+type AddCredentialRequest struct {
+	Credential       *Credential `protobuf:"bytes,1,req,name=credential" json:"credential,omitempty"`
+	XXX_unrecognized []byte      `json:"-"`
+}
+
+func (m *AddCredentialRequest) Reset()         { *m = AddCredentialRequest{} }
+func (m *AddCredentialRequest) String() string { return proto.CompactTextString(m) }
+func (*AddCredentialRequest) ProtoMessage()    {}
+
+func (m *AddCredentialRequest) GetCredential() *Credential {
+	if m != nil {
+		return m.Credential
+	}
+	return nil
+}
+
+type RemoveCredentialRequest struct {
+	Name             *string `protobuf:"bytes,1,req,name=name" json:"name,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *RemoveCredentialRequest) Reset()         { *m = RemoveCredentialRequest{} }
+func (m *RemoveCredentialRequest) String() string { return proto.CompactTextString(m) }
+func (*RemoveCredentialRequest) ProtoMessage()    {}
+
+func (m *RemoveCredentialRequest) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+type CredentialsRequest struct {
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *CredentialsRequest) Reset()         { *m = CredentialsRequest{} }
+func (m *CredentialsRequest) String() string { return proto.CompactTextString(m) }
+func (*CredentialsRequest) ProtoMessage()    {}
+
+type CredentialsResponse struct {
+	Credentials      []*Credential `protobuf:"bytes,1,rep,name=credentials" json:"credentials,omitempty"`
+	XXX_unrecognized []byte        `json:"-"`
+}
+
+func (m *CredentialsResponse) Reset()         { *m = CredentialsResponse{} }
+func (m *CredentialsResponse) String() string { return proto.CompactTextString(m) }
+func (*CredentialsResponse) ProtoMessage()    {}
+
+func (m *CredentialsResponse) GetCredentials() []*Credential {
+	if m != nil {
+		return m.Credentials
+	}
+	return nil
+}
+
 func init() {
+	proto.RegisterEnum("format.JobStatus", JobStatus_name, JobStatus_value)
+	proto.RegisterEnum("format.ErrorCode", ErrorCode_name, ErrorCode_value)
+	proto.RegisterEnum("format.EventType", EventType_name, EventType_value)
+	proto.RegisterEnum("format.DeliveryState", DeliveryState_name, DeliveryState_value)
+	proto.RegisterEnum("format.CredentialKind", CredentialKind_name, CredentialKind_value)
 }
@@ -0,0 +1,469 @@
+package format
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+//default Client settings, see NewClient.
+const (
+	DefaultTimeout = 30 * time.Second
+	DefaultRetries = 2
+	DefaultBackoff = 500 * time.Millisecond
+	InfoTTL        = time.Minute // how long the daemon features are cached
+)
+
+//Client is a typed client of the daemon protocol: one method per request, and
+// errors as go values (see StatusError, and ServerError).
+//
+// Calls that can safely be sent twice (list, log, apply, export, wait) are
+// retried on network errors, and on http 5xx statuses.
+//
+// Before using a feature that an older daemon would not understand, the client
+// checks the daemon features (see Require).
+type Client struct {
+	*ProtoClient
+	Timeout time.Duration // of each attempt, 0 for none
+	Retries int           // extra attempts of idempotent calls
+	Backoff time.Duration // delay before the first retry, doubled for each next one
+
+	mu     sync.Mutex    // protects info
+	info   *InfoResponse // cached daemon info, see Require
+	infoAt time.Time
+}
+
+//NewClient creates a Client for the daemon at 'url', with the default settings.
+func NewClient(url string) *Client {
+	return &Client{
+		ProtoClient: NewProtoClient(url),
+		Timeout:     DefaultTimeout,
+		Retries:     DefaultRetries,
+		Backoff:     DefaultBackoff,
+	}
+}
+
+//StatusError is returned when the daemon answers with an http status other than 200,
+// and no response message (e.g. from a proxy).
+type StatusError struct {
+	Code    int    // http status code
+	Status  string // http status line
+	Message string // response body
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return e.Status
+	}
+	return e.Status + ": " + e.Message
+}
+
+//Temporary returns true if 'err' may not happen again: network errors,
+// timeouts, and http 5xx or 429 statuses.
+func Temporary(err error) bool {
+	switch e := err.(type) {
+	case *StatusError:
+		return e.Code >= 500 || e.Code == http.StatusTooManyRequests
+	case *url.Error:
+		_, ok := e.Err.(net.Error)
+		return ok
+	case net.Error:
+		return true
+	}
+	return false
+}
+
+//Info returns the daemon version, and features. Daemons that predate the info
+// request are reported with protocol 0, and no features.
+func (c *Client) Info(ctx context.Context) (*InfoResponse, error) {
+	resp, err := c.call(ctx, &Request{Info: &InfoRequest{}}, true, 0)
+	if err == nil && resp.GetInfo() != nil {
+		return resp.GetInfo(), nil
+	}
+	if !unknownRequest(resp, err) {
+		return nil, err
+	}
+	unknown := "unknown"
+	protocol := int32(0)
+	return &InfoResponse{Version: &unknown, Protocol: &protocol}, nil
+}
+
+//unknownRequest returns true if 'resp', or 'err' is the reply of a daemon that
+// does not know the request: an empty response (or, with older protobuf versions,
+// a failure to marshal it) before error codes, UnknownRequest since.
+func unknownRequest(resp *Response, err error) bool {
+	switch e := err.(type) {
+	case nil:
+		return resp.GetError() == ""
+	case *ServerError:
+		return e.Code == ErrorCode_INVALID_ARGUMENT && e.Message == UnknownRequest
+	case *StatusError:
+		return e.Code == http.StatusInternalServerError && strings.Contains(e.Message, "Marshal called with nil")
+	}
+	return false
+}
+
+//Require returns an *UnsupportedError if the daemon does not support 'feature',
+// or if its protocol is newer than this client's one.
+//
+// The daemon info is cached for InfoTTL.
+func (c *Client) Require(ctx context.Context, feature string) error {
+	c.mu.Lock()
+	info := c.info
+	if time.Since(c.infoAt) > InfoTTL {
+		info = nil
+	}
+	c.mu.Unlock()
+
+	if info == nil {
+		var err error
+		info, err = c.Info(ctx)
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.info, c.infoAt = info, time.Now()
+		c.mu.Unlock()
+	}
+
+	switch {
+	case info.GetProtocol() > ProtocolVersion:
+		return &UnsupportedError{URL: c.URL, Version: info.GetVersion(), Protocol: info.GetProtocol()}
+	case !info.Supports(feature):
+		return &UnsupportedError{URL: c.URL, Feature: feature, Version: info.GetVersion(), Protocol: info.GetProtocol()}
+	}
+	return nil
+}
+
+//ListJobs returns the jobs having all the 'selector' labels (all jobs if empty).
+//
+// Execution results, and the build history are only included on demand.
+func (c *Client) ListJobs(ctx context.Context, refreshResult, buildResult, history bool, selector []*Label) ([]*Job, error) {
+	if len(selector) > 0 { // an older daemon would list all jobs
+		if err := c.Require(ctx, FeatureLabels); err != nil {
+			return nil, err
+		}
+	}
+	req := &Request{
+		List: &ListRequest{
+			RefreshResult: proto.Bool(refreshResult),
+			BuildResult:   proto.Bool(buildResult),
+			History:       proto.Bool(history),
+			Selector:      selector,
+		},
+	}
+	resp, err := c.call(ctx, req, true, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetList().GetJobs(), nil
+}
+
+//Job returns a single job, with its outputs and history.
+func (c *Client) Job(ctx context.Context, name string) (*Job, error) {
+	req := &Request{Log: &LogRequest{Jobname: &name}}
+	resp, err := c.call(ctx, req, true, 0)
+	if err != nil {
+		return nil, err
+	}
+	if resp.GetLog().GetJob() == nil {
+		return nil, Errorf(ErrorCode_NOT_FOUND, "no such job %q.", name)
+	}
+	return resp.GetLog().GetJob(), nil
+}
+
+//AddJob creates a job, with its variables, and secrets.
+func (c *Client) AddJob(ctx context.Context, name, remote, branch string, labels, env, secrets map[string]string) error {
+	if len(labels) > 0 { // an older daemon would drop them
+		if err := c.Require(ctx, FeatureLabels); err != nil {
+			return err
+		}
+	}
+	if len(env)+len(secrets) > 0 {
+		if err := c.Require(ctx, FeatureEnv); err != nil {
+			return err
+		}
+	}
+	req := &Request{
+		Add: &AddRequest{
+			Id: &Jobid{
+				Name:    &name,
+				Remote:  &remote,
+				Branch:  &branch,
+				Labels:  NewLabels(labels),
+				Env:     NewVariables(env),
+				Secrets: NewSecrets(secrets),
+			},
+		},
+	}
+	_, err := c.call(ctx, req, false, 0)
+	return err
+}
+
+//RemoveJob removes a job.
+func (c *Client) RemoveJob(ctx context.Context, name string) error {
+	req := &Request{Remove: &RemoveRequest{Jobname: &name}}
+	_, err := c.call(ctx, req, false, 0)
+	return err
+}
+
+//ApplyJobs reconciles the daemon jobs with 'jobs'.
+//
+// On error, the response holds the changes made before the error, if any.
+func (c *Client) ApplyJobs(ctx context.Context, jobs []*Jobid, prune, dryrun bool) (*ApplyResponse, error) {
+	if err := c.Require(ctx, FeatureApply); err != nil {
+		return nil, err
+	}
+	for _, id := range jobs {
+		if len(id.GetLabels()) > 0 {
+			if err := c.Require(ctx, FeatureLabels); err != nil {
+				return nil, err
+			}
+		}
+		if len(id.GetEnv())+len(id.GetSecrets()) > 0 {
+			if err := c.Require(ctx, FeatureEnv); err != nil {
+				return nil, err
+			}
+		}
+	}
+	req := &Request{
+		Apply: &ApplyRequest{
+			Jobs:   jobs,
+			Prune:  proto.Bool(prune),
+			Dryrun: proto.Bool(dryrun),
+		},
+	}
+	resp, err := c.call(ctx, req, true, 0)
+	return resp.GetApply(), err
+}
+
+//ExportJobs returns all jobs, with their last executions if 'history' is true.
+func (c *Client) ExportJobs(ctx context.Context, history bool) ([]*Job, error) {
+	if err := c.Require(ctx, FeatureExport); err != nil {
+		return nil, err
+	}
+	req := &Request{Export: &ExportRequest{History: proto.Bool(history)}}
+	resp, err := c.call(ctx, req, true, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetExport().GetJobs(), nil
+}
+
+//ImportJobs creates 'jobs', replacing the existing ones if 'overwrite' is true.
+//
+// On error, the response holds the jobs imported before the error, if any.
+func (c *Client) ImportJobs(ctx context.Context, jobs []*Job, overwrite bool) (*ImportResponse, error) {
+	if err := c.Require(ctx, FeatureImport); err != nil {
+		return nil, err
+	}
+	req := &Request{
+		Import: &ImportRequest{
+			Jobs:      jobs,
+			Overwrite: proto.Bool(overwrite),
+		},
+	}
+	resp, err := c.call(ctx, req, false, 0)
+	return resp.GetImport(), err
+}
+
+//BuildJob runs a job now, even if its version has already been built when 'force' is true.
+func (c *Client) BuildJob(ctx context.Context, name string, force bool) error {
+	if err := c.Require(ctx, FeatureBuild); err != nil {
+		return err
+	}
+	req := &Request{Build: &BuildRequest{Jobname: &name, Force: proto.Bool(force)}}
+	_, err := c.call(ctx, req, false, 0)
+	return err
+}
+
+//CancelJob stops a job's run.
+func (c *Client) CancelJob(ctx context.Context, name string) error {
+	if err := c.Require(ctx, FeatureCancel); err != nil {
+		return err
+	}
+	req := &Request{Cancel: &CancelRequest{Jobname: &name}}
+	_, err := c.call(ctx, req, false, 0)
+	return err
+}
+
+//WaitJob waits until the job's run ends, or, if 'version' is not empty, until a
+// run of another version ends, or a run fails to refresh. It returns the job, and
+// false if 'timeout' expired first, or a NOT_FOUND error if the job is removed.
+//
+// The daemon caps 'timeout' (see ci.MaxWait).
+func (c *Client) WaitJob(ctx context.Context, name, version string, timeout time.Duration) (*Job, bool, error) {
+	if err := c.Require(ctx, FeatureWait); err != nil {
+		return nil, false, err
+	}
+	seconds := int64(timeout / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	req := &Request{
+		Wait: &WaitRequest{
+			Jobname: &name,
+			Version: &version,
+			Timeout: &seconds,
+		},
+	}
+	resp, err := c.call(ctx, req, true, timeout)
+	if err != nil {
+		return nil, false, err
+	}
+	return resp.GetWait().GetJob(), resp.GetWait().GetDone(), nil
+}
+
+//DefaultWatch is the watch timeout, when the request does not set one.
+const DefaultWatch = 30 * time.Second
+
+//WatchJobs waits until jobs change after the 'q' revision, or until its timeout
+// expires. The response holds the changes, and the revision for the next call.
+func (c *Client) WatchJobs(ctx context.Context, q *WatchRequest) (*WatchResponse, error) {
+	if err := c.Require(ctx, FeatureWatch); err != nil {
+		return nil, err
+	}
+	if q.GetTimeout() <= 0 {
+		q.Timeout = proto.Int64(int64(DefaultWatch / time.Second))
+	}
+	if len(q.GetSelector()) > 0 {
+		if err := c.Require(ctx, FeatureLabels); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := c.call(ctx, &Request{Watch: q}, true, time.Duration(q.GetTimeout())*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetWatch(), nil
+}
+
+//Events returns the journal events matching 'q', oldest first. If there is none,
+// and 'q' has a timeout, it waits for one.
+func (c *Client) Events(ctx context.Context, q *EventsRequest) ([]*Event, error) {
+	if err := c.Require(ctx, FeatureEvents); err != nil {
+		return nil, err
+	}
+	resp, err := c.call(ctx, &Request{Events: q}, true, time.Duration(q.GetTimeout())*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetEvents().GetEvents(), nil
+}
+
+//AddHook creates an outgoing webhook.
+func (c *Client) AddHook(ctx context.Context, h *Hook) error {
+	if err := c.Require(ctx, FeatureHooks); err != nil {
+		return err
+	}
+	_, err := c.call(ctx, &Request{AddHook: &AddHookRequest{Hook: h}}, false, 0)
+	return err
+}
+
+//RemoveHook removes an outgoing webhook.
+func (c *Client) RemoveHook(ctx context.Context, name string) error {
+	if err := c.Require(ctx, FeatureHooks); err != nil {
+		return err
+	}
+	_, err := c.call(ctx, &Request{RemoveHook: &RemoveHookRequest{Name: &name}}, false, 0)
+	return err
+}
+
+//Hooks returns the webhooks, and their deliveries matching 'q'.
+func (c *Client) Hooks(ctx context.Context, q *HooksRequest) (*HooksResponse, error) {
+	if err := c.Require(ctx, FeatureHooks); err != nil {
+		return nil, err
+	}
+	resp, err := c.call(ctx, &Request{Hooks: q}, true, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetHooks(), nil
+}
+
+//Redeliver sends a delivery again, and returns the new delivery.
+func (c *Client) Redeliver(ctx context.Context, id int64) (*Delivery, error) {
+	if err := c.Require(ctx, FeatureHooks); err != nil {
+		return nil, err
+	}
+	resp, err := c.call(ctx, &Request{Redeliver: &RedeliverRequest{Delivery: &id}}, false, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetRedeliver().GetDelivery(), nil
+}
+
+//AddCredential creates git credentials.
+func (c *Client) AddCredential(ctx context.Context, cred *Credential) error {
+	if err := c.Require(ctx, FeatureCredentials); err != nil {
+		return err
+	}
+	_, err := c.call(ctx, &Request{AddCredential: &AddCredentialRequest{Credential: cred}}, false, 0)
+	return err
+}
+
+//RemoveCredential removes git credentials.
+func (c *Client) RemoveCredential(ctx context.Context, name string) error {
+	if err := c.Require(ctx, FeatureCredentials); err != nil {
+		return err
+	}
+	_, err := c.call(ctx, &Request{RemoveCredential: &RemoveCredentialRequest{Name: &name}}, false, 0)
+	return err
+}
+
+//Credentials returns the git credentials, without their secret.
+func (c *Client) Credentials(ctx context.Context) ([]*Credential, error) {
+	if err := c.Require(ctx, FeatureCredentials); err != nil {
+		return nil, err
+	}
+	resp, err := c.call(ctx, &Request{Credentials: &CredentialsRequest{}}, true, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetCredentials().GetCredentials(), nil
+}
+
+//call sends 'req', and retries it if 'idempotent'. 'wait' is how long the daemon
+// may hold the request, on top of the client timeout.
+func (c *Client) call(ctx context.Context, req *Request, idempotent bool, wait time.Duration) (*Response, error) {
+	attempts := 1
+	if idempotent {
+		attempts += c.Retries
+	}
+	backoff := c.Backoff
+	for i := 1; ; i++ {
+		resp, err := c.attempt(ctx, req, wait)
+		if err == nil || i >= attempts || !Temporary(err) || ctx.Err() != nil {
+			return resp, err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+//attempt sends 'req' once.
+func (c *Client) attempt(ctx context.Context, req *Request, wait time.Duration) (*Response, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout+wait)
+		defer cancel()
+	}
+	resp, err := c.ProtoContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return resp, &ServerError{Code: resp.GetCode(), Message: resp.GetError()}
+	}
+	return resp, nil
+}
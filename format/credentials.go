@@ -0,0 +1,16 @@
+package format
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+//MarshalJSON writes the kind as its name, e.g. "SSH_KEY".
+func (x CredentialKind) MarshalJSON() ([]byte, error) {
+	return json.Marshal(x.String())
+}
+
+//Label returns a human readable label: "ssh key", or "https token".
+func (x CredentialKind) Label() string {
+	return strings.Replace(strings.ToLower(x.String()), "_", " ", -1)
+}
@@ -0,0 +1,88 @@
+package format
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+//variableName matches valid environment variable names.
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+//sortedKeys returns the keys of 'm', sorted.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//NewVariables converts a map into variables, sorted by name.
+func NewVariables(m map[string]string) []*Variable {
+	vars := make([]*Variable, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		name, value := k, m[k]
+		vars = append(vars, &Variable{Name: &name, Value: &value})
+	}
+	return vars
+}
+
+//VariableMap converts variables into a map, it fails on invalid names, or if a
+// name is declared twice.
+func VariableMap(vars []*Variable) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, v := range vars {
+		if !variableName.MatchString(v.GetName()) {
+			return nil, fmt.Errorf("invalid variable name %q", v.GetName())
+		}
+		if _, exists := m[v.GetName()]; exists {
+			return nil, fmt.Errorf("variable %q is declared twice", v.GetName())
+		}
+		m[v.GetName()] = v.GetValue()
+	}
+	return m, nil
+}
+
+//NewSecrets converts a map into secrets with their value, sorted by name. Empty
+// values are left unset: the daemon keeps the current ones.
+func NewSecrets(m map[string]string) []*Secret {
+	secrets := make([]*Secret, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		name := k
+		s := &Secret{Name: &name}
+		if m[k] != "" {
+			value := m[k]
+			s.Value = &value
+		}
+		secrets = append(secrets, s)
+	}
+	return secrets
+}
+
+//SecretNames returns the secrets of 'm' without their value, sorted by name.
+func SecretNames(m map[string]string) []*Secret {
+	secrets := make([]*Secret, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		name := k
+		secrets = append(secrets, &Secret{Name: &name})
+	}
+	return secrets
+}
+
+//SecretMap converts secrets into a map of their value ("" if unset), it fails on
+// invalid names, or if a name is declared twice.
+func SecretMap(secrets []*Secret) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, s := range secrets {
+		if !variableName.MatchString(s.GetName()) {
+			return nil, fmt.Errorf("invalid secret name %q", s.GetName())
+		}
+		if _, exists := m[s.GetName()]; exists {
+			return nil, fmt.Errorf("secret %q is declared twice", s.GetName())
+		}
+		m[s.GetName()] = s.GetValue()
+	}
+	return m, nil
+}
@@ -0,0 +1,53 @@
+package format
+
+import (
+	"fmt"
+	"net/http"
+)
+
+//ServerError is an error reported in a response: the daemon returns them, and
+// the Client decodes them.
+type ServerError struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (e *ServerError) Error() string { return e.Message }
+
+//UnknownRequest is the message of the INVALID_ARGUMENT error returned for requests
+// that the daemon does not know.
+const UnknownRequest = "empty or unknown request."
+
+//Errorf creates a ServerError.
+func Errorf(code ErrorCode, format string, args ...interface{}) *ServerError {
+	return &ServerError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+//Code returns the code of 'err', INTERNAL if it is not a *ServerError.
+func Code(err error) ErrorCode {
+	if e, ok := err.(*ServerError); ok {
+		return e.Code
+	}
+	return ErrorCode_INTERNAL
+}
+
+//NewErrorResponse returns a response reporting 'err'.
+func NewErrorResponse(err error) *Response {
+	msg := err.Error()
+	return &Response{Error: &msg, Code: Code(err).Enum()}
+}
+
+//HTTPStatus returns the http status of a response reporting this code.
+func (c ErrorCode) HTTPStatus() int {
+	switch c {
+	case ErrorCode_NOT_FOUND:
+		return http.StatusNotFound
+	case ErrorCode_ALREADY_EXISTS:
+		return http.StatusConflict
+	case ErrorCode_INVALID_ARGUMENT:
+		return http.StatusBadRequest
+	case ErrorCode_UNAUTHORIZED:
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,16 @@
+package format
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+//MarshalJSON writes the event type as its name, e.g. "BUILD_FINISHED".
+func (x EventType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(x.String())
+}
+
+//Label returns a human readable label: "build finished", "job added", etc.
+func (x EventType) Label() string {
+	return strings.Replace(strings.ToLower(x.String()), "_", " ", -1)
+}
@@ -0,0 +1,65 @@
+package format
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+//webhook request headers.
+const (
+	HookEventHeader     = "X-CI-Event"     // the event type name, e.g. BUILD_FINISHED
+	HookDeliveryHeader  = "X-CI-Delivery"  // the delivery id
+	HookSignatureHeader = "X-CI-Signature" // the payload signature, if the hook has a secret (see Sign)
+)
+
+//HookPayload is the json body that the daemon POSTs to webhooks.
+type HookPayload struct {
+	Hook  string `json:"hook"`          // the hook name
+	Event *Event `json:"event"`         // the event delivered
+	Job   *Job   `json:"job,omitempty"` // the job status (without outputs) at the event time, nil once removed
+}
+
+//Sign returns the signature of a webhook 'body': "sha256=" followed by the hex HMAC-SHA256 of 'body' keyed with 'secret'.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//Verify returns true if 'signature' is the signature of 'body', see Sign.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+//DefaultHookEvents are the events delivered to a hook that does not list any.
+var DefaultHookEvents = []EventType{EventType_BUILD_FINISHED}
+
+//Matches returns true if the event 'e' must be delivered to the hook.
+func (m *Hook) Matches(e *Event) bool {
+	if m.GetJobname() != "" && m.GetJobname() != e.GetJobname() {
+		return false
+	}
+	events := m.GetEvents()
+	if len(events) == 0 {
+		events = DefaultHookEvents
+	}
+	for _, t := range events {
+		if t == e.GetType() {
+			return true
+		}
+	}
+	return false
+}
+
+//MarshalJSON writes the state as its name, e.g. "DELIVERY_FAILED".
+func (x DeliveryState) MarshalJSON() ([]byte, error) {
+	return json.Marshal(x.String())
+}
+
+//Label returns a human readable label: "pending", "succeeded", or "failed".
+func (x DeliveryState) Label() string {
+	return strings.ToLower(strings.TrimPrefix(x.String(), "DELIVERY_"))
+}
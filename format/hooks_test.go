@@ -0,0 +1,39 @@
+package format
+
+import "testing"
+
+func TestSign(t *testing.T) {
+	for _, x := range []struct {
+		secret, body, want string
+	}{
+		// RFC 4231, test case 2
+		{"Jefe", "what do ya want for nothing?", "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"},
+		{"key", "The quick brown fox jumps over the lazy dog", "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"},
+	} {
+		if got := Sign(x.secret, []byte(x.body)); got != x.want {
+			t.Errorf("Sign(%q, %q) = %q, want %q", x.secret, x.body, got, x.want)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"hook":"slack"}`)
+	signature := Sign("s3cr3t", body)
+	for _, x := range []struct {
+		name      string
+		secret    string
+		body      []byte
+		signature string
+		want      bool
+	}{
+		{"valid", "s3cr3t", body, signature, true},
+		{"other secret", "other", body, signature, false},
+		{"other body", "s3cr3t", []byte(`{"hook":"other"}`), signature, false},
+		{"no scheme", "s3cr3t", body, signature[len("sha256="):], false},
+		{"empty", "s3cr3t", body, "", false},
+	} {
+		if got := Verify(x.secret, x.body, x.signature); got != x.want {
+			t.Errorf("%s: got %v, want %v", x.name, got, x.want)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package format
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
 	"net/http"
+	"strings"
 
 	"github.com/golang/protobuf/proto"
 )
@@ -16,11 +18,12 @@ const (
 // exchange.
 type ProtoClient struct {
 	*http.Client
-	URL string
+	URL   string
+	Token string // sent as a bearer token, if not empty
 }
 
-//NewClient just create a default instance of ProtoClient.
-func NewClient(url string) *ProtoClient {
+//NewProtoClient just create a default instance of ProtoClient.
+func NewProtoClient(url string) *ProtoClient {
 	return &ProtoClient{
 		Client: http.DefaultClient,
 		URL:    url,
@@ -31,24 +34,39 @@ func NewClient(url string) *ProtoClient {
 // performs a "POST" with a pbrequest encoded in the body, and wait for an http response with
 // a format.Response  encoded.
 func (c *ProtoClient) Proto(pbrequest *Request) (resp *Response, err error) {
+	return c.ProtoContext(context.Background(), pbrequest)
+}
+
+//ProtoContext is Proto, canceled with 'ctx'. An http status other than 200 is
+// returned as a *StatusError, unless the body is a Response reporting the error.
+func (c *ProtoClient) ProtoContext(ctx context.Context, pbrequest *Request) (resp *Response, err error) {
 
 	//create the request
 	r, err := http.NewRequest("POST", c.URL, nil)
 	if err != nil {
 		return
 	}
+	r = r.WithContext(ctx)
 
 	//fill it with the proto Request object
 	err = RequestEncode(r, pbrequest)
 	if err != nil {
 		return
 	}
+	if c.Token != "" {
+		r.Header.Set("Authorization", "Bearer "+c.Token)
+	}
 
 	//actually run the http layer
 	httpr, err := c.Do(r)
 	if err != nil {
 		return
 	}
+	defer httpr.Body.Close()
+	if httpr.StatusCode != http.StatusOK && httpr.Header.Get("Content-Type") != mimetype_pb {
+		msg, _ := ioutil.ReadAll(httpr.Body)
+		return nil, &StatusError{Code: httpr.StatusCode, Status: httpr.Status, Message: strings.TrimSpace(string(msg))}
+	}
 
 	// and read the result.
 	resp = new(Response)
@@ -61,12 +79,16 @@ func (c *ProtoClient) Proto(pbrequest *Request) (resp *Response, err error) {
 }
 
 //ResponseWriterEncode encode a format.Response into the ResponseWriter.
+// The http status is derived from the response error code, if any.
 func ResponseWriterEncode(w http.ResponseWriter, data *Response) error {
-	w.Header().Set("Content-Type", mimetype_pb)
 	b, err := proto.Marshal(data)
 	if err != nil {
 		return err
 	}
+	w.Header().Set("Content-Type", mimetype_pb)
+	if data.Error != nil {
+		w.WriteHeader(data.GetCode().HTTPStatus())
+	}
 	w.Write(b)
 	return nil
 }
@@ -0,0 +1,70 @@
+package format
+
+import "fmt"
+
+//ProtocolVersion is the version of this protocol, it is increased when a change
+// breaks older clients. Daemons that predate the info request have protocol 0.
+const ProtocolVersion = 1
+
+//features advertised in an info response. Requests that predate it (list, log,
+// add, and remove) are always supported.
+const (
+	FeatureInfo        = "info"        // the info request
+	FeatureLabels      = "labels"      // job labels, and list selectors
+	FeatureApply       = "apply"       // the apply request
+	FeatureExport      = "export"      // the export request
+	FeatureImport      = "import"      // the import request
+	FeatureBuild       = "build"       // the build request
+	FeatureCancel      = "cancel"      // the cancel request
+	FeatureWait        = "wait"        // the wait request
+	FeatureErrorCodes  = "errorcodes"  // error codes in responses
+	FeatureWatch       = "watch"       // the watch request
+	FeatureEvents      = "events"      // the events request
+	FeatureHooks       = "hooks"       // outgoing webhooks, and their requests
+	FeatureEnv         = "env"         // job variables, and secrets
+	FeatureCredentials = "credentials" // git credentials, and their requests
+)
+
+//Features are the features of this protocol version.
+var Features = []string{
+	FeatureInfo,
+	FeatureLabels,
+	FeatureApply,
+	FeatureExport,
+	FeatureImport,
+	FeatureBuild,
+	FeatureCancel,
+	FeatureWait,
+	FeatureErrorCodes,
+	FeatureWatch,
+	FeatureEvents,
+	FeatureHooks,
+	FeatureEnv,
+	FeatureCredentials,
+}
+
+//Supports returns true if the daemon supports 'feature'.
+func (m *InfoResponse) Supports(feature string) bool {
+	for _, f := range m.GetFeatures() {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+//UnsupportedError is returned by the Client when the daemon is too old for a
+// request, or when the client is too old for the daemon.
+type UnsupportedError struct {
+	URL      string
+	Feature  string // empty if the daemon protocol is newer
+	Version  string // daemon version
+	Protocol int32  // daemon protocol version
+}
+
+func (e *UnsupportedError) Error() string {
+	if e.Feature == "" {
+		return fmt.Sprintf("the daemon at %s (version %s) speaks protocol %d, this client only knows protocol %d: upgrade the client.", e.URL, e.Version, e.Protocol, ProtocolVersion)
+	}
+	return fmt.Sprintf("the daemon at %s (version %s) does not support %q: upgrade the daemon.", e.URL, e.Version, e.Feature)
+}
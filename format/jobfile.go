@@ -0,0 +1,264 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	DefaultBranch = "master"
+)
+
+//JobFile is the declarative description of all the jobs a daemon should run.
+//
+// It is read from a yaml (or json) file like:
+//
+//    jobs:
+//      - name: mrepo
+//        remote: git@github.com:ericaro/mrepo.git
+//        branch: master
+//        labels:
+//          team: infra
+//        env:
+//          GOFLAGS: -mod=vendor
+//        secrets:
+//          NPM_TOKEN: $NPM_TOKEN
+//
+// A secret value that is a single variable ($VAR, or ${VAR}) is read from the
+// environment, so that the file needs not contain it, it must be set. Other
+// values are literal. A secret without value keeps the daemon's one.
+//
+// An exported JobFile may also contain the jobs' last refresh and build, their
+// build history, and the secret names, without their value.
+type JobFile struct {
+	Jobs []JobSpec `yaml:"jobs" json:"jobs"`
+}
+
+//JobSpec describes a single job in a JobFile.
+type JobSpec struct {
+	Name    string            `yaml:"name" json:"name"`
+	Remote  string            `yaml:"remote" json:"remote"`
+	Branch  string            `yaml:"branch,omitempty" json:"branch,omitempty"`
+	Labels  map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	Secrets map[string]string `yaml:"secrets,omitempty" json:"secrets,omitempty"`
+	Refresh *ExecutionSpec    `yaml:"refresh,omitempty" json:"refresh,omitempty"`
+	Build   *ExecutionSpec    `yaml:"build,omitempty" json:"build,omitempty"`
+	History []*ExecutionSpec  `yaml:"history,omitempty" json:"history,omitempty"` // previous builds, most recent first
+}
+
+//ExecutionSpec is the JobFile counterpart of an Execution.
+type ExecutionSpec struct {
+	Version string `yaml:"version" json:"version"`
+	Start   int64  `yaml:"start" json:"start"`
+	End     int64  `yaml:"end" json:"end"`
+	Errcode int32  `yaml:"errcode" json:"errcode"`
+	Result  string `yaml:"result,omitempty" json:"result,omitempty"`
+}
+
+//NewJobFile builds a JobFile out of jobs (see exportResponse).
+func NewJobFile(jobs []*Job) *JobFile {
+	f := &JobFile{Jobs: make([]JobSpec, 0, len(jobs))}
+	for _, j := range jobs {
+		labels, _ := LabelMap(j.GetId().GetLabels())
+		if len(labels) == 0 {
+			labels = nil
+		}
+		env, _ := VariableMap(j.GetId().GetEnv())
+		if len(env) == 0 {
+			env = nil
+		}
+		secrets, _ := SecretMap(j.GetId().GetSecrets())
+		if len(secrets) == 0 {
+			secrets = nil
+		}
+		f.Jobs = append(f.Jobs, JobSpec{
+			Name:    j.GetId().GetName(),
+			Remote:  j.GetId().GetRemote(),
+			Branch:  j.GetId().GetBranch(),
+			Labels:  labels,
+			Env:     env,
+			Secrets: secrets,
+			Refresh: newExecutionSpec(j.GetRefresh()),
+			Build:   newExecutionSpec(j.GetBuild()),
+			History: newExecutionSpecs(j.GetHistory()),
+		})
+	}
+	return f
+}
+
+func newExecutionSpec(x *Execution) *ExecutionSpec {
+	if x == nil {
+		return nil
+	}
+	return &ExecutionSpec{
+		Version: x.GetVersion(),
+		Start:   x.GetStart(),
+		End:     x.GetEnd(),
+		Errcode: x.GetErrcode(),
+		Result:  x.GetResult(),
+	}
+}
+
+func newExecutionSpecs(xs []*Execution) []*ExecutionSpec {
+	if len(xs) == 0 {
+		return nil
+	}
+	specs := make([]*ExecutionSpec, 0, len(xs))
+	for _, x := range xs {
+		specs = append(specs, newExecutionSpec(x))
+	}
+	return specs
+}
+
+func (s *ExecutionSpec) execution() *Execution {
+	if s == nil {
+		return nil
+	}
+	x := *s // copy, to take addresses
+	return &Execution{
+		Version: &x.Version,
+		Start:   &x.Start,
+		End:     &x.End,
+		Errcode: &x.Errcode,
+		Result:  &x.Result,
+	}
+}
+
+func executions(specs []*ExecutionSpec) []*Execution {
+	xs := make([]*Execution, 0, len(specs))
+	for _, s := range specs {
+		if s != nil {
+			xs = append(xs, s.execution())
+		}
+	}
+	return xs
+}
+
+//ReadJobFile reads and validates a JobFile.
+func ReadJobFile(filename string) (*JobFile, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	f := new(JobFile)
+	if err := yaml.Unmarshal(b, f); err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %s", filename, err.Error())
+	}
+	if err := f.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", filename, err.Error())
+	}
+	return f, nil
+}
+
+//Validate checks that every job has a name and a remote, and that names are unique.
+//
+// Missing branches are set to DefaultBranch, and secret values that are a single
+// variable are read from the environment (see JobFile).
+func (f *JobFile) Validate() error {
+	names := make(map[string]bool)
+	for i := range f.Jobs {
+		s := &f.Jobs[i]
+		if s.Name == "" {
+			return fmt.Errorf("job #%d has no name", i)
+		}
+		if s.Remote == "" {
+			return fmt.Errorf("job %q has no remote", s.Name)
+		}
+		if names[s.Name] {
+			return fmt.Errorf("job %q is declared twice", s.Name)
+		}
+		names[s.Name] = true
+		if s.Branch == "" {
+			s.Branch = DefaultBranch
+		}
+		for k := range s.Labels {
+			if k == "" || strings.ContainsAny(k, "=,") {
+				return fmt.Errorf("job %q has an invalid label key %q", s.Name, k)
+			}
+		}
+		for k := range s.Env {
+			if !variableName.MatchString(k) {
+				return fmt.Errorf("job %q has an invalid variable name %q", s.Name, k)
+			}
+		}
+		for k, v := range s.Secrets {
+			if !variableName.MatchString(k) {
+				return fmt.Errorf("job %q has an invalid secret name %q", s.Name, k)
+			}
+			m := secretVariable.FindStringSubmatch(v)
+			if m == nil {
+				continue
+			}
+			name := m[1] + m[2]
+			value, set := os.LookupEnv(name)
+			if !set {
+				return fmt.Errorf("job %q: secret %q reads $%s, that is not set", s.Name, k, name)
+			}
+			s.Secrets[k] = value
+		}
+	}
+	return nil
+}
+
+//secretVariable matches secret values read from the environment: $VAR, or ${VAR}.
+var secretVariable = regexp.MustCompile(`^\$(?:([A-Za-z_][A-Za-z0-9_]*)|\{([A-Za-z_][A-Za-z0-9_]*)\})$`)
+
+//Jobids converts the file into the jobid messages used by the applyRequest.
+func (f *JobFile) Jobids() []*Jobid {
+	ids := make([]*Jobid, 0, len(f.Jobs))
+	for _, s := range f.Jobs {
+		name, remote, branch := s.Name, s.Remote, s.Branch
+		ids = append(ids, &Jobid{
+			Name:    &name,
+			Remote:  &remote,
+			Branch:  &branch,
+			Labels:  NewLabels(s.Labels),
+			Env:     NewVariables(s.Env),
+			Secrets: NewSecrets(s.Secrets),
+		})
+	}
+	return ids
+}
+
+//JobMessages converts the file into the job messages used by the importRequest.
+func (f *JobFile) JobMessages() []*Job {
+	ids := f.Jobids()
+	jobs := make([]*Job, 0, len(ids))
+	for i, id := range ids {
+		jobs = append(jobs, &Job{
+			Id:      id,
+			Refresh: f.Jobs[i].Refresh.execution(),
+			Build:   f.Jobs[i].Build.execution(),
+			History: executions(f.Jobs[i].History),
+		})
+	}
+	return jobs
+}
+
+//Empty returns true if the apply has changed nothing.
+func (m *ApplyResponse) Empty() bool {
+	return len(m.GetAdded())+len(m.GetUpdated())+len(m.GetRemoved()) == 0
+}
+
+//Diff returns a human readable description of the changes: one line per job
+// prefixed by '+' (added), '~' (updated) or '-' (removed).
+func (m *ApplyResponse) Diff() string {
+	buf := new(bytes.Buffer)
+	for _, n := range m.GetAdded() {
+		fmt.Fprintf(buf, "+ %s\n", n)
+	}
+	for _, n := range m.GetUpdated() {
+		fmt.Fprintf(buf, "~ %s\n", n)
+	}
+	for _, n := range m.GetRemoved() {
+		fmt.Fprintf(buf, "- %s\n", n)
+	}
+	return buf.String()
+}
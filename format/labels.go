@@ -0,0 +1,81 @@
+package format
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//ParseLabels parses a comma separated list of labels: "team=infra,lang=go".
+func ParseLabels(s string) ([]*Label, error) {
+	var labels []*Label
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		i := strings.Index(kv, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid label %q, expecting key=value", kv)
+		}
+		key, value := kv[:i], kv[i+1:]
+		labels = append(labels, &Label{Key: &key, Value: &value})
+	}
+	return labels, nil
+}
+
+//NewLabels converts a map into labels, sorted by key.
+func NewLabels(m map[string]string) []*Label {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	labels := make([]*Label, 0, len(keys))
+	for _, k := range keys {
+		key, value := k, m[k]
+		labels = append(labels, &Label{Key: &key, Value: &value})
+	}
+	return labels
+}
+
+//LabelMap converts labels into a map, it fails if a key is declared twice.
+func LabelMap(labels []*Label) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, l := range labels {
+		if l.GetKey() == "" {
+			return nil, fmt.Errorf("label without a key")
+		}
+		if _, exists := m[l.GetKey()]; exists {
+			return nil, fmt.Errorf("label %q is declared twice", l.GetKey())
+		}
+		m[l.GetKey()] = l.GetValue()
+	}
+	return m, nil
+}
+
+//LabelString is the reverse of ParseLabels.
+func LabelString(labels []*Label) string {
+	s := make([]string, 0, len(labels))
+	for _, l := range labels {
+		s = append(s, l.GetKey()+"="+l.GetValue())
+	}
+	return strings.Join(s, ",")
+}
+
+//Matches returns true if the job has all the labels in 'selector'.
+func (m *Jobid) Matches(selector []*Label) bool {
+	for _, sel := range selector {
+		found := false
+		for _, l := range m.GetLabels() {
+			if l.GetKey() == sel.GetKey() && l.GetValue() == sel.GetValue() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package format
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+//Errcodes with a semantic. Process exit codes are positive, so these are negative.
+const (
+	ErrcodeFailed      int32 = -1 // any other failure
+	ErrcodeCancelled   int32 = -2 // the execution has been cancelled
+	ErrcodeTimedOut    int32 = -3 // the execution took too long
+	ErrcodeInterrupted int32 = -4 // the daemon stopped during the execution
+)
+
+//State returns the job status computed by the daemon, or, for daemons that do not
+// send it, an approximation computed from the executions.
+func (m *Job) State() JobStatus {
+	if m != nil && m.Status != nil {
+		return *m.Status
+	}
+	return ComputeStatus(m, false)
+}
+
+//ComputeStatus computes the status of a job from its executions.
+//
+// 'queued' is true if a run is scheduled, only the daemon knows about that.
+func ComputeStatus(j *Job, queued bool) JobStatus {
+	refresh, build := j.GetRefresh(), j.GetBuild()
+	switch {
+	case running(refresh):
+		return JobStatus_PULLING
+	case running(build):
+		return JobStatus_BUILDING
+	case queued:
+		return JobStatus_QUEUED
+	case refresh.GetErrcode() != 0:
+		return failure(refresh.GetErrcode())
+	case build.GetStart() == 0:
+		return JobStatus_NEVER_BUILT
+	case build.GetErrcode() != 0:
+		return failure(build.GetErrcode())
+	case refresh.GetVersion() != build.GetVersion():
+		return JobStatus_IDLE
+	default:
+		return JobStatus_SUCCESS
+	}
+}
+
+//running returns true if the execution has started, but is not yet finished.
+func running(x *Execution) bool { return x.GetStart() != 0 && x.GetEnd() < x.GetStart() }
+
+//failure converts a non zero errcode into a status.
+func failure(errcode int32) JobStatus {
+	switch errcode {
+	case ErrcodeCancelled:
+		return JobStatus_CANCELLED
+	case ErrcodeTimedOut:
+		return JobStatus_TIMED_OUT
+	case ErrcodeInterrupted:
+		return JobStatus_INTERRUPTED
+	default:
+		return JobStatus_FAILED
+	}
+}
+
+//Running returns true if the job is being executed (pulling or building).
+func (x JobStatus) Running() bool {
+	return x == JobStatus_PULLING || x == JobStatus_BUILDING
+}
+
+//Failed returns true if the last execution did not succeed.
+func (x JobStatus) Failed() bool {
+	switch x {
+	case JobStatus_FAILED, JobStatus_CANCELLED, JobStatus_TIMED_OUT, JobStatus_INTERRUPTED:
+		return true
+	}
+	return false
+}
+
+//MarshalJSON writes the status as its name, e.g. "SUCCESS", rather than its number.
+func (x JobStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(x.String())
+}
+
+//Label returns a human readable label: "never built", "timed out", etc.
+func (x JobStatus) Label() string {
+	return strings.Replace(strings.ToLower(x.String()), "_", " ", -1)
+}
+
+//Class returns a css friendly class name: "never-built", "timed-out", etc.
+func (x JobStatus) Class() string {
+	return strings.Replace(strings.ToLower(x.String()), "_", "-", -1)
+}
+
+//Outcome returns the status of a single execution: running (as BUILDING), success or a failure.
+func (m *Execution) Outcome() JobStatus {
+	switch {
+	case m.GetStart() == 0:
+		return JobStatus_NEVER_BUILT
+	case running(m):
+		return JobStatus_BUILDING
+	case m.GetErrcode() != 0:
+		return failure(m.GetErrcode())
+	default:
+		return JobStatus_SUCCESS
+	}
+}
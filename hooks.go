@@ -0,0 +1,416 @@
+package ci
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ericaro/ci/format"
+	"github.com/golang/protobuf/proto"
+)
+
+//webhook delivery settings: a delivery is attempted HookAttempts times, waiting
+// HookBackoff before the first retry, and twice as long before each next one.
+var (
+	HookAttempts = 5
+	HookBackoff  = 10 * time.Second
+	HookTimeout  = 10 * time.Second // of each attempt
+)
+
+//DeliveriesSize is the number of deliveries kept in the delivery log.
+const DeliveriesSize = 1000
+
+//DefaultDeliveries is the number of deliveries returned by a hooks request without limit.
+const DefaultDeliveries = 20
+
+//hooks delivers the job events to the outgoing webhooks, and keeps the delivery
+// log: the last DeliveriesSize deliveries, kept in memory, and appended to a
+// file (one json delivery per line, see journal) if the log is persisted. A
+// delivery is appended with its payload when it starts, each next change
+// appends it without.
+type hooks struct {
+	mu         sync.Mutex
+	hooks      map[string]*format.Hook       // name -> hook
+	deliveries []*format.Delivery            // the log, oldest first
+	last       int64                         // id of the last delivery
+	file       *journal                      // the log file, nil if not persisted
+	client     *http.Client                  // sends the deliveries
+	job        func(name string) *format.Job // the job status, nil if there is no such job
+}
+
+func newHooks(job func(name string) *format.Job) *hooks {
+	return &hooks{
+		hooks:  make(map[string]*format.Hook),
+		client: &http.Client{Timeout: HookTimeout},
+		job:    job,
+	}
+}
+
+//openLog loads the delivery log from 'filename', and appends the next changes to it.
+//
+// Deliveries that were pending when the daemon stopped are marked as failed, they
+// can be redelivered. The file is compacted to the last DeliveriesSize deliveries
+// first, and again each time it holds twice as many lines.
+func (h *hooks) openLog(filename string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	index := make(map[int64]int) // id -> index in h.deliveries
+	err := readJournal(filename, func(data []byte) error {
+		d := new(format.Delivery)
+		if err := json.Unmarshal(data, d); err != nil {
+			return err
+		}
+		if i, exists := index[d.GetId()]; exists { // the last change wins
+			if d.Payload == nil {
+				d.Payload = h.deliveries[i].Payload
+			}
+			h.deliveries[i] = d
+			return nil
+		}
+		if d.Payload == nil { // its start is no longer in the log
+			return nil
+		}
+		index[d.GetId()] = len(h.deliveries)
+		h.deliveries = append(h.deliveries, d)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(h.deliveries) > DeliveriesSize {
+		h.deliveries = h.deliveries[len(h.deliveries)-DeliveriesSize:]
+	}
+	for _, d := range h.deliveries {
+		if d.GetId() > h.last {
+			h.last = d.GetId()
+		}
+		if d.GetState() == format.DeliveryState_DELIVERY_PENDING {
+			d.State = format.DeliveryState_DELIVERY_FAILED.Enum()
+			d.Error = proto.String("interrupted by a daemon restart")
+		}
+	}
+	file := &journal{filename: filename, size: DeliveriesSize}
+	if err := file.rewrite(h.values()); err != nil {
+		return err
+	}
+	h.file = file
+	return nil
+}
+
+//values returns the deliveries of the log, to be written. h.mu must be held.
+func (h *hooks) values() []interface{} {
+	values := make([]interface{}, 0, len(h.deliveries))
+	for _, d := range h.deliveries {
+		values = append(values, d)
+	}
+	return values
+}
+
+//add creates a hook.
+func (h *hooks) add(hook *format.Hook) error {
+	if hook.GetName() == "" {
+		return format.Errorf(format.ErrorCode_INVALID_ARGUMENT, "cannot add a hook without a name.")
+	}
+	u, err := url.Parse(hook.GetUrl())
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return format.Errorf(format.ErrorCode_INVALID_ARGUMENT, "hook %q: invalid url %q, expecting http(s)://host/path.", hook.GetName(), hook.GetUrl())
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, exists := h.hooks[hook.GetName()]; exists {
+		return format.Errorf(format.ErrorCode_ALREADY_EXISTS, "a hook with this name already exists.")
+	}
+	h.hooks[hook.GetName()] = &format.Hook{
+		Name:    hook.Name,
+		Url:     hook.Url,
+		Jobname: hook.Jobname,
+		Events:  hook.Events,
+		Secret:  hook.Secret,
+	}
+	return nil
+}
+
+//remove removes a hook, its ongoing deliveries are not retried.
+func (h *hooks) remove(name string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, exists := h.hooks[name]; !exists {
+		return format.Errorf(format.ErrorCode_NOT_FOUND, "no such hook %q.", name)
+	}
+	delete(h.hooks, name)
+	return nil
+}
+
+//list returns the hooks, without their secret, and the deliveries matching 'q',
+// without their payload.
+func (h *hooks) list(q *format.HooksRequest) *format.HooksResponse {
+	limit := int(q.GetLimit())
+	if limit <= 0 {
+		limit = DefaultDeliveries
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	resp := new(format.HooksResponse)
+	for _, hook := range h.hooks {
+		resp.Hooks = append(resp.Hooks, &format.Hook{
+			Name:    hook.Name,
+			Url:     hook.Url,
+			Jobname: hook.Jobname,
+			Events:  hook.Events,
+			Signed:  proto.Bool(hook.GetSecret() != ""),
+		})
+	}
+	sort.Sort(hooksByName(resp.Hooks))
+
+	for i := len(h.deliveries) - 1; i >= 0 && len(resp.Deliveries) < limit; i-- {
+		d := h.deliveries[i]
+		if q.GetHook() != "" && d.GetHook() != q.GetHook() {
+			continue
+		}
+		if q.GetFailed() && d.GetState() != format.DeliveryState_DELIVERY_FAILED {
+			continue
+		}
+		x := *d
+		x.Payload = nil
+		resp.Deliveries = append(resp.Deliveries, &x)
+	}
+	for i, j := 0, len(resp.Deliveries)-1; i < j; i, j = i+1, j-1 {
+		resp.Deliveries[i], resp.Deliveries[j] = resp.Deliveries[j], resp.Deliveries[i]
+	}
+	return resp
+}
+
+type hooksByName []*format.Hook
+
+func (x hooksByName) Len() int           { return len(x) }
+func (x hooksByName) Less(i, j int) bool { return x[i].GetName() < x[j].GetName() }
+func (x hooksByName) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
+
+//marshal returns all the hooks, with their secret sealed by 's', to be persisted.
+// Without a key, hooks with a secret are not persisted.
+func (h *hooks) marshal(s *sealer) []*format.Hook {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	list := make([]*format.Hook, 0, len(h.hooks))
+	for _, hook := range h.hooks {
+		if hook.GetSecret() == "" {
+			list = append(list, hook)
+			continue
+		}
+		if s == nil {
+			continue
+		}
+		x := *hook
+		x.Secret = nil
+		x.Sealed = s.seal("hook/"+hook.GetName(), hook.GetSecret())
+		list = append(list, &x)
+	}
+	sort.Sort(hooksByName(list))
+	return list
+}
+
+//unmarshal replaces the hooks, with their secret opened by 's'. Hooks whose
+// secret cannot be opened (e.g. with another key) are dropped, rather than sending
+// unsigned payloads. Secrets persisted in clear by previous versions are kept.
+func (h *hooks) unmarshal(s *sealer, list []*format.Hook) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hooks = make(map[string]*format.Hook)
+	for _, hook := range list {
+		if hook.Sealed != nil {
+			var secret string
+			err := errors.New("no key")
+			if s != nil {
+				secret, err = s.open("hook/"+hook.GetName(), hook.Sealed)
+			}
+			if err != nil {
+				log.Printf("error.daemon.hook.secret:%q", fmt.Sprintf("%s: %s", hook.GetName(), err.Error()))
+				continue
+			}
+			x := *hook
+			x.Sealed = nil
+			x.Secret = proto.String(secret)
+			hook = &x
+		}
+		h.hooks[hook.GetName()] = hook
+	}
+}
+
+//run delivers 'events' to the matching hooks, until the channel is closed.
+func (h *hooks) run(events <-chan *format.Event) {
+	for e := range events {
+		h.dispatch(e)
+	}
+}
+
+//dispatch starts a delivery of 'e' to each matching hook.
+func (h *hooks) dispatch(e *format.Event) {
+	h.mu.Lock()
+	var matching []string
+	for name, hook := range h.hooks {
+		if hook.Matches(e) {
+			matching = append(matching, name)
+		}
+	}
+	h.mu.Unlock()
+	if len(matching) == 0 {
+		return
+	}
+
+	job := h.job(e.GetJobname())
+	for _, name := range matching {
+		payload, err := json.Marshal(&format.HookPayload{Hook: name, Event: e, Job: job})
+		if err != nil {
+			log.Printf("error.daemon.hook.payload:%q", err.Error())
+			continue
+		}
+		h.start(&format.Delivery{
+			Hook:    proto.String(name),
+			Event:   e,
+			Payload: proto.String(string(payload)),
+		})
+	}
+}
+
+//redeliver starts a new delivery of the payload of the delivery 'id'.
+func (h *hooks) redeliver(id int64) (*format.Delivery, error) {
+	h.mu.Lock()
+	var old *format.Delivery
+	for _, d := range h.deliveries {
+		if d.GetId() == id {
+			old = d
+		}
+	}
+	h.mu.Unlock()
+	if old == nil {
+		return nil, format.Errorf(format.ErrorCode_NOT_FOUND, "no such delivery %d.", id)
+	}
+	d := h.start(&format.Delivery{
+		Hook:       old.Hook,
+		Event:      old.Event,
+		Payload:    old.Payload,
+		Redelivery: proto.Int64(id),
+	})
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	x := *d
+	x.Payload = nil
+	return &x, nil
+}
+
+//start records a new delivery 'd', and sends it in the background.
+func (h *hooks) start(d *format.Delivery) *format.Delivery {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.last++
+	d.Id = proto.Int64(h.last)
+	d.State = format.DeliveryState_DELIVERY_PENDING.Enum()
+	d.Attempts = proto.Int32(0)
+	h.deliveries = append(h.deliveries, d)
+	if len(h.deliveries) > DeliveriesSize {
+		h.deliveries = append(h.deliveries[:0], h.deliveries[len(h.deliveries)-DeliveriesSize:]...)
+	}
+	h.record(d, true)
+	go h.deliver(d)
+	return d
+}
+
+//record appends the delivery 'd' to the log, with its payload if 'payload' is
+// true. h.mu must be held.
+func (h *hooks) record(d *format.Delivery, payload bool) {
+	if h.file == nil {
+		return
+	}
+	if !payload {
+		x := *d
+		x.Payload = nil
+		d = &x
+	}
+	if err := h.file.append(d, h.values); err != nil {
+		log.Printf("error.daemon.hook.log:%q", err.Error())
+	}
+}
+
+//deliver sends 'd' until it succeeds, fails permanently, or all attempts failed.
+func (h *hooks) deliver(d *format.Delivery) {
+	backoff := HookBackoff
+	for attempt := 1; ; attempt++ {
+		h.mu.Lock()
+		hook, exists := h.hooks[d.GetHook()]
+		h.mu.Unlock()
+
+		var status int
+		var err error
+		if exists {
+			status, err = h.send(hook, d)
+		} else {
+			err = fmt.Errorf("hook %q has been removed", d.GetHook())
+		}
+
+		h.mu.Lock()
+		d.Attempts = proto.Int32(int32(attempt))
+		d.Status = proto.Int32(int32(status))
+		d.Time = proto.Int64(time.Now().Unix())
+		d.Error = nil
+		retry := false
+		switch {
+		case err == nil:
+			d.State = format.DeliveryState_DELIVERY_SUCCEEDED.Enum()
+		default:
+			d.Error = proto.String(err.Error())
+			// 4xx statuses would be the same next time, except timeouts, and rate limits.
+			permanent := !exists || status >= 400 && status < 500 && status != http.StatusRequestTimeout && status != http.StatusTooManyRequests
+			retry = !permanent && attempt < HookAttempts
+			if !retry {
+				d.State = format.DeliveryState_DELIVERY_FAILED.Enum()
+				log.Printf("error.daemon.hook.delivery:%q", fmt.Sprintf("%s #%d: %s", d.GetHook(), d.GetId(), err.Error()))
+			}
+		}
+		h.record(d, false)
+		h.mu.Unlock()
+
+		if !retry {
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+//send POSTs the delivery payload to the hook, and returns the http status.
+func (h *hooks) send(hook *format.Hook, d *format.Delivery) (int, error) {
+	body := []byte(d.GetPayload())
+	req, err := http.NewRequest("POST", hook.GetUrl(), bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ci-daemon/"+Version)
+	req.Header.Set(format.HookEventHeader, d.GetEvent().GetType().String())
+	req.Header.Set(format.HookDeliveryHeader, strconv.FormatInt(d.GetId(), 10))
+	if hook.GetSecret() != "" {
+		req.Header.Set(format.HookSignatureHeader, format.Sign(hook.GetSecret(), body))
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16)) // to reuse the connection
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("%s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,154 @@
+package ci
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ericaro/ci/format"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestDeliver(t *testing.T) {
+	attempts, backoff := HookAttempts, HookBackoff
+	defer func() { HookAttempts, HookBackoff = attempts, backoff }()
+	HookAttempts, HookBackoff = 3, time.Millisecond
+
+	for _, x := range []struct {
+		name     string
+		statuses []int // the response statuses, the last one is repeated
+		state    format.DeliveryState
+		attempts int32
+	}{
+		{"ok", []int{200}, format.DeliveryState_DELIVERY_SUCCEEDED, 1},
+		{"accepted", []int{202}, format.DeliveryState_DELIVERY_SUCCEEDED, 1},
+		{"retried", []int{500, 502, 200}, format.DeliveryState_DELIVERY_SUCCEEDED, 3},
+		{"server errors", []int{503}, format.DeliveryState_DELIVERY_FAILED, 3},
+		{"bad request", []int{400, 200}, format.DeliveryState_DELIVERY_FAILED, 1},
+		{"not found", []int{404, 200}, format.DeliveryState_DELIVERY_FAILED, 1},
+		{"timeout", []int{408, 200}, format.DeliveryState_DELIVERY_SUCCEEDED, 2},
+		{"rate limited", []int{429}, format.DeliveryState_DELIVERY_FAILED, 3},
+		{"redirect", []int{304}, format.DeliveryState_DELIVERY_FAILED, 3},
+	} {
+		var mu sync.Mutex
+		var requests []*http.Request
+		var bodies []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			mu.Lock()
+			defer mu.Unlock()
+			requests = append(requests, r)
+			bodies = append(bodies, string(body))
+			i := len(requests) - 1
+			if i >= len(x.statuses) {
+				i = len(x.statuses) - 1
+			}
+			w.WriteHeader(x.statuses[i])
+		}))
+
+		h := newHooks(nil)
+		if err := h.add(&format.Hook{Name: proto.String("hook"), Url: proto.String(server.URL), Secret: proto.String("s3cr3t")}); err != nil {
+			t.Fatal(err)
+		}
+		d := &format.Delivery{
+			Id:      proto.Int64(7),
+			Hook:    proto.String("hook"),
+			Event:   &format.Event{Type: format.EventType_BUILD_FINISHED.Enum(), Jobname: proto.String("a")},
+			Payload: proto.String(`{"hook":"hook"}`),
+		}
+		h.deliver(d)
+		server.Close()
+
+		if d.GetState() != x.state || d.GetAttempts() != x.attempts || len(requests) != int(x.attempts) {
+			t.Errorf("%s: got %v after %d attempts (%d requests), want %v after %d", x.name, d.GetState(), d.GetAttempts(), len(requests), x.state, x.attempts)
+		}
+		if x.state == format.DeliveryState_DELIVERY_FAILED && d.GetError() == "" {
+			t.Errorf("%s: failed without an error", x.name)
+		}
+		for i, r := range requests {
+			if r.Header.Get(format.HookSignatureHeader) != format.Sign("s3cr3t", []byte(bodies[i])) ||
+				r.Header.Get(format.HookEventHeader) != "BUILD_FINISHED" || r.Header.Get(format.HookDeliveryHeader) != "7" {
+				t.Errorf("%s: invalid headers %v", x.name, r.Header)
+			}
+		}
+	}
+}
+
+func TestDeliverRemovedHook(t *testing.T) {
+	h := newHooks(nil)
+	d := &format.Delivery{Id: proto.Int64(1), Hook: proto.String("removed"), Event: new(format.Event)}
+	h.deliver(d)
+	if d.GetState() != format.DeliveryState_DELIVERY_FAILED || d.GetAttempts() != 1 {
+		t.Errorf("got %v after %d attempts, want a single failed attempt", d.GetState(), d.GetAttempts())
+	}
+}
+
+func TestOpenLog(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	filename := filepath.Join(dir, "ci.db.deliveries")
+
+	pending := format.DeliveryState_DELIVERY_PENDING.Enum()
+	failed := format.DeliveryState_DELIVERY_FAILED.Enum()
+	succeeded := format.DeliveryState_DELIVERY_SUCCEEDED.Enum()
+	// as recorded: with the payload when started, without afterwards.
+	file := &journal{filename: filename, size: DeliveriesSize}
+	if err := file.rewrite([]interface{}{
+		&format.Delivery{Id: proto.Int64(1), Hook: proto.String("a"), State: pending, Payload: proto.String("one")},
+		&format.Delivery{Id: proto.Int64(2), Hook: proto.String("a"), State: pending, Payload: proto.String("two")},
+		&format.Delivery{Id: proto.Int64(1), Hook: proto.String("a"), State: succeeded, Attempts: proto.Int32(1)},
+		&format.Delivery{Id: proto.Int64(2), Hook: proto.String("a"), State: pending, Attempts: proto.Int32(1)},
+		&format.Delivery{Id: proto.Int64(3), Hook: proto.String("a"), State: failed, Attempts: proto.Int32(5)}, // its start was compacted
+	}); err != nil {
+		t.Fatal(err)
+	}
+	file.file.Write([]byte(`{"id":4,"hook":"a","sta`)) // killed while writing
+	file.file.Close()
+
+	h := newHooks(nil)
+	if err := h.openLog(filename); err != nil {
+		t.Fatal(err)
+	}
+	defer h.file.file.Close()
+
+	want := []struct {
+		id      int64
+		state   format.DeliveryState
+		payload string
+	}{
+		{1, format.DeliveryState_DELIVERY_SUCCEEDED, "one"},
+		{2, format.DeliveryState_DELIVERY_FAILED, "two"}, // interrupted by the restart
+	}
+	if len(h.deliveries) != len(want) {
+		t.Fatalf("got %d deliveries, want %d", len(h.deliveries), len(want))
+	}
+	for i, w := range want {
+		d := h.deliveries[i]
+		if d.GetId() != w.id || d.GetState() != w.state || d.GetPayload() != w.payload {
+			t.Errorf("delivery %d: got %v", w.id, d)
+		}
+	}
+	if !strings.Contains(h.deliveries[1].GetError(), "restart") {
+		t.Errorf("interrupted delivery: got error %q", h.deliveries[1].GetError())
+	}
+	if h.last != 2 {
+		t.Errorf("last id: got %d, want 2", h.last)
+	}
+
+	// the log is compacted, and the next deliveries are appended.
+	h.mu.Lock()
+	h.record(&format.Delivery{Id: proto.Int64(3), Hook: proto.String("a"), State: pending, Payload: proto.String("three")}, true)
+	h.mu.Unlock()
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 3 || h.file.lines != 3 {
+		t.Errorf("got %d lines (%d counted), want 3", lines, h.file.lines)
+	}
+}
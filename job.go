@@ -2,12 +2,15 @@ package ci
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/ericaro/ci/format"
-	"github.com/ericaro/mrepo"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"sync"
 	"time"
@@ -17,39 +20,133 @@ import (
 // it is configured by a unique name, a remote url (git url to checkout the project)
 // and a branch to checkout.
 type job struct {
-	name   string
-	remote string
-	branch string
+	name    string
+	remote  string
+	branch  string
+	labels  map[string]string // free-form labels, to filter jobs
+	env     map[string]string // environment variables of the job processes
+	secrets map[string]string // secret environment variables, never returned (see format.Secret)
 	// cmd      string    // the command executed as a CI (default `make`)
 	// args     []string  // args of the ci command default `ci`
 
 	//other fields are local one.
-	at       *time.Timer
-	refresh  execution // info about the refresh execution
-	build    execution // info about the build execution
-	execLock sync.Mutex
+	at          *time.Timer
+	queued      bool        // true when a run is scheduled
+	running     bool        // true during a run, including between the refresh and the build
+	force       bool        // true to build the next run, even if the version has already been built
+	refresh     execution   // info about the refresh execution
+	build       execution   // info about the build execution
+	stages      []*stage    // info about each build stage, if the job has a pipeline file
+	history     []execution // previous builds, most recent first (without result)
+	execLock    sync.Mutex
+	cancel      context.CancelFunc // stops the ongoing run, nil if there is none
+	cancelLock  sync.Mutex         // protects cancel, and stopped
+	stopped     bool               // true once the job is removed from the daemon, it never runs again
+	changed     chan struct{}      // closed when the job state changes, see Changed()
+	changedLock sync.Mutex         // protects changed, revision, and outputSoon
+	revs        *revisions         // the daemon revisions, nil without a daemon
+	revision    uint64             // the daemon revision of the last change
+	outputSoon  bool               // true when a notify is scheduled for new outputs
+	bus         *bus               // the daemon events, nil without a daemon
+	creds       *credentials       // the daemon git credentials, nil without a daemon
+	wd          string             // the job's parent directory, the process working dir if empty
+	out         io.Writer          // if not nil, receives the outputs live
 }
 
-func RunJobNow(name, remote, branch string) {
-	j := &job{name: name, remote: remote, branch: branch}
-	j.doRun()
-	fmt.Println(j.refresh.result.String())
-	fmt.Println(j.build.result.String())
-	fmt.Println("done")
+//RunJobNow refreshes and builds a job in 'wd', without a daemon, until 'ctx' is done.
+//
+// Outputs are streamed to 'w' as they are produced. The build is forced, it
+// returns the job status at the end.
+func RunJobNow(ctx context.Context, wd, name, remote, branch string, w io.Writer) *format.Job {
+	j := &job{name: name, remote: remote, branch: branch, wd: wd, out: w, force: true}
+	j.run(ctx)
+	return j.Status(false, false)
+}
 
+//workdir returns the job's parent directory.
+func (j *job) workdir() (string, error) {
+	if j.wd != "" {
+		return j.wd, nil
+	}
+	return os.Getwd()
 }
 
-//Marshal serialize all information into a format.Job object.
-func (j *job) Marshal() *format.Job { return j.Status(true, true) }
+//writer returns a writer for an execution 'result', that also streams to j.out.
+//
+// Writes are job changes, they are notified at most every OutputPeriod.
+func (j *job) writer(result io.Writer) io.Writer {
+	w := io.MultiWriter(result, outputWriter{j})
+	if j.out == nil {
+		return w
+	}
+	return io.MultiWriter(w, j.out)
+}
+
+//OutputPeriod is the maximum delay before new outputs are notified, see job.Changed.
+const OutputPeriod = 500 * time.Millisecond
 
-func (j *job) State() Status {
-	if j.refresh.start.After(j.refresh.end) || j.build.start.After(j.build.end) {
-		return StatusRunning
+//outputWriter notifies the job changes when something is written.
+type outputWriter struct{ j *job }
+
+func (w outputWriter) Write(p []byte) (int, error) {
+	j := w.j
+	j.changedLock.Lock()
+	defer j.changedLock.Unlock()
+	if !j.outputSoon { // coalesce writes
+		j.outputSoon = true
+		time.AfterFunc(OutputPeriod, j.notify)
 	}
-	if j.refresh.errcode == 0 && j.build.errcode == 0 {
-		return StatusOK
+	return len(p), nil
+}
+
+//sameMap returns true if 'a' and 'b' hold the same values (labels, variables...).
+func sameMap(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
 	}
-	return StatusKO
+	for k, v := range b {
+		if w, exists := a[k]; !exists || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+//keepSecrets returns 'secrets', where secrets without value have the value in
+// 'current', if any, or are dropped.
+func keepSecrets(current, secrets map[string]string) map[string]string {
+	m := make(map[string]string)
+	for k, v := range secrets {
+		if v == "" {
+			v = current[k]
+		}
+		if v != "" {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+//HistorySize is the number of builds kept in a job's history.
+const HistorySize = 20
+
+//Marshal serialize all information into a format.Job object.
+func (j *job) Marshal() *format.Job { return j.Details() }
+
+//Details is the full Status, with the build history.
+func (j *job) Details() *format.Job {
+	f := j.Status(true, true)
+	f.History = j.History()
+	return f
+}
+
+//History serialize the build history.
+func (j *job) History() []*format.Execution {
+	h := make([]*format.Execution, 0, len(j.history))
+	for i := range j.history {
+		h = append(h, j.history[i].Status(false))
+	}
+	return h
 }
 
 //Status serialize information into a format.Job object.
@@ -58,15 +155,25 @@ func (j *job) State() Status {
 //
 // if withBuild if will include the build output
 func (j *job) Status(withRefresh, withBuild bool) *format.Job {
-	return &format.Job{
+	stages := make([]*format.Stage, 0, len(j.stages))
+	for _, s := range j.stages {
+		stages = append(stages, s.Status(withBuild))
+	}
+	f := &format.Job{
 		Id: &format.Jobid{
-			Name:   &j.name,
-			Remote: &j.remote,
-			Branch: &j.branch,
+			Name:    &j.name,
+			Remote:  &j.remote,
+			Branch:  &j.branch,
+			Labels:  format.NewLabels(j.labels),
+			Env:     format.NewVariables(j.env),
+			Secrets: format.SecretNames(j.secrets),
 		},
 		Refresh: j.refresh.Status(withRefresh),
 		Build:   j.build.Status(withBuild),
+		Stages:  stages,
 	}
+	f.Status = format.ComputeStatus(f, j.queued || j.running).Enum()
+	return f
 }
 
 //Unmarshal initialise the current job with values from the format.Job message
@@ -76,6 +183,18 @@ func (j *job) Unmarshal(f *format.Job) error {
 	j.name = id.GetName()
 	j.remote = id.GetRemote()
 	j.branch = id.GetBranch()
+	labels, err := format.LabelMap(id.GetLabels())
+	if err != nil {
+		return err
+	}
+	j.labels = labels
+	if j.env, err = format.VariableMap(id.GetEnv()); err != nil {
+		return err
+	}
+	// sealed values are opened by the daemon, see ci.Unmarshal
+	if j.secrets, err = format.SecretMap(id.GetSecrets()); err != nil {
+		return err
+	}
 
 	if err := j.refresh.Unmarshal(f.GetRefresh()); err != nil {
 		return err
@@ -83,71 +202,245 @@ func (j *job) Unmarshal(f *format.Job) error {
 	if err := j.build.Unmarshal(f.GetBuild()); err != nil {
 		return err
 	}
+	j.history = nil
+	for _, fx := range f.GetHistory() {
+		var x execution
+		if err := x.Unmarshal(fx); err != nil {
+			return err
+		}
+		j.history = append(j.history, x)
+	}
+	j.stages = nil
+	for _, fs := range f.GetStages() {
+		s := new(stage)
+		if err := s.Unmarshal(fs); err != nil {
+			return err
+		}
+		j.stages = append(j.stages, s)
+	}
 	return nil
 }
 
+//Update changes the job's remote, branch, labels, variables, and secrets (see keepSecrets).
+//
+// It waits for any ongoing execution, and if the remote or branch has changed,
+// removes the local directory: it belongs to the previous remote, the next
+// refresh will clone it again.
+func (j *job) Update(remote, branch string, labels, env, secrets map[string]string) error {
+	j.execLock.Lock()
+	defer j.execLock.Unlock()
+	defer j.notify()
+	j.labels, j.env = labels, env
+	j.secrets = keepSecrets(j.secrets, secrets)
+	if j.remote == remote && j.branch == branch {
+		return nil
+	}
+	j.remote, j.branch = remote, branch
+
+	if err := os.RemoveAll(j.name); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove job's local directory: %s", err.Error())
+	}
+	return nil
+}
+
+//Changed returns a channel that is closed on the next change of the job state.
+func (j *job) Changed() <-chan struct{} {
+	j.changedLock.Lock()
+	defer j.changedLock.Unlock()
+	if j.changed == nil {
+		j.changed = make(chan struct{})
+	}
+	return j.changed
+}
+
+//Revision returns the daemon revision of the job's last change.
+func (j *job) Revision() uint64 {
+	j.changedLock.Lock()
+	defer j.changedLock.Unlock()
+	return j.revision
+}
+
+//notify wakes up everyone waiting on Changed(), and records a new revision.
+func (j *job) notify() {
+	j.changedLock.Lock()
+	defer j.changedLock.Unlock()
+	j.outputSoon = false
+	if j.revs != nil {
+		j.revision = j.revs.next()
+	}
+	if j.changed != nil {
+		close(j.changed)
+		j.changed = nil
+	}
+}
+
 //Run schedules (or reschedule) a run
 func (j *job) Run() {
 	j.RunWithDelay(10 * time.Second)
 }
 
 func (j *job) RunWithDelay(delay time.Duration) {
+	if j.isStopped() {
+		return
+	}
+	j.queued = true
+	defer j.notify()
 	if j.at == nil { // never scheduled before
 		log.Printf("%s Run scheduled in %v", j.name, delay)
 		j.at = time.AfterFunc(delay, j.doRun)
+		j.emit(format.EventType_JOB_SCHEDULED, nil, fmt.Sprintf("in %v", delay))
 	} else {
 		stopped := j.at.Reset(delay) // reschedule for a delay (either restart it or cancel before restarting)
 		if stopped {
 			log.Printf("%s Run postponed in %v", j.name, delay)
+			j.emit(format.EventType_JOB_SCHEDULED, nil, fmt.Sprintf("postponed in %v", delay))
 		} else {
 			log.Printf("%s Run scheduled in %v", j.name, delay)
+			j.emit(format.EventType_JOB_SCHEDULED, nil, fmt.Sprintf("in %v", delay))
 		}
 	}
 }
 
+//Cancel stops the ongoing run, and unschedule the next one.
+//
+// It returns false if there was nothing to cancel.
+func (j *job) Cancel() bool {
+	cancelled := false
+	if j.queued && j.at != nil && j.at.Stop() {
+		j.queued = false
+		cancelled = true
+	}
+	j.cancelLock.Lock()
+	defer j.cancelLock.Unlock()
+	if j.cancel != nil {
+		j.cancel()
+		cancelled = true
+	}
+	if cancelled {
+		j.notify()
+		j.emit(format.EventType_JOB_CANCELLED, nil, "")
+	}
+	return cancelled
+}
+
+//Stop stops the job for good, when it is removed from the daemon: its next run is
+// unscheduled, its ongoing run cancelled, and it never executes again.
+//
+// It waits for the current execution, that cannot be interrupted if it is a
+// refresh: the daemon must not be locked meanwhile.
+func (j *job) Stop() {
+	j.cancelLock.Lock()
+	j.stopped = true
+	if j.at != nil {
+		j.at.Stop()
+	}
+	j.queued = false
+	if j.cancel != nil {
+		j.cancel()
+	}
+	j.cancelLock.Unlock()
+	j.notify() // wakes up the waits, they find the job removed
+
+	j.execLock.Lock()
+	j.execLock.Unlock() // executions starting from now on do nothing.
+}
+
+//isStopped returns true if the job has been stopped, see Stop.
+func (j *job) isStopped() bool {
+	j.cancelLock.Lock()
+	defer j.cancelLock.Unlock()
+	return j.stopped
+}
+
+//setCancel sets the function that stops the ongoing run.
+func (j *job) setCancel(cancel context.CancelFunc) {
+	j.cancelLock.Lock()
+	defer j.cancelLock.Unlock()
+	j.cancel = cancel
+}
+
 //doRun really execute the run
-func (j *job) doRun() {
+func (j *job) doRun() { j.run(context.Background()) }
+
+//run executes a run, until 'ctx' is done, or the run is cancelled.
+func (j *job) run(parent context.Context) {
+	ctx, cancel := context.WithCancel(parent)
+	j.setCancel(cancel)
+	defer func() {
+		j.setCancel(nil)
+		cancel()
+		j.running = false
+		j.notify()
+	}()
+
+	j.running = true
+	j.queued = false
+	j.notify()
 	log.Printf("Pulling %s", j.name)
-	j.Refresh()
+	j.Refresh(ctx)
 	log.Printf("Building %s", j.name)
-	j.Build()
+	j.Build(ctx)
 }
 
 //Refresh the current job.
 //
-// Skip if there is an ongoing job.
-func (j *job) Refresh() {
+// Skip if there is an ongoing job. The refresh itself cannot be interrupted, but
+// it is marked as cancelled if 'ctx' is done when it ends.
+func (j *job) Refresh(ctx context.Context) {
 	j.execLock.Lock()
 	defer j.execLock.Unlock()
+	if j.isStopped() {
+		return
+	}
 
 	//to start we refresh all information: buffer, and start time.
 	j.refresh.result = new(bytes.Buffer)
 	j.refresh.start = time.Now() // mark the job as started
-	j.refresh.errcode = 0        // no semantic here... yet
-	defer func() {               // we will update stuff at the end
+	j.refresh.errcode = 0        // reset, until it fails
+	j.notify()
+	j.emit(format.EventType_REFRESH_STARTED, nil, "")
+	defer func() { // we will update stuff at the end
 		j.refresh.end = time.Now() // mark the job as ended at the end of this call.
+		j.notify()
+		j.emit(format.EventType_REFRESH_FINISHED, &j.refresh, "")
 	}()
 	// do the job now and return
-	if err := j.dorefresh(j.refresh.result); err != nil {
-		j.refresh.errcode = -1 // no semantic here... yet
-		fmt.Fprintln(j.refresh.result, err.Error())
+	w := j.redactor(j.writer(j.refresh.result))
+	defer w.Flush()
+	err := j.dorefresh(w)
+	if err == nil && ctx.Err() != nil {
+		err = errCancelled
+	}
+	if err != nil {
+		j.refresh.errcode = errcode(err)
+		fmt.Fprintln(w, err.Error())
 	} else {
 		j.refresh.errcode = 0
 	}
 	log.Printf("Done refreshing job %s", j.name)
 }
 
-//Build the current job
-func (j *job) Build() {
+//Build the current job, until 'ctx' is done.
+func (j *job) Build(ctx context.Context) {
 
 	j.execLock.Lock()
 	defer j.execLock.Unlock()
+	if j.isStopped() {
+		return
+	}
+
+	if ctx.Err() != nil {
+		log.Printf("job %s has been cancelled", j.name)
+		j.emit(format.EventType_BUILD_SKIPPED, &j.refresh, "cancelled")
+		return
+	}
 
 	// check that the version has changed
 	/* temp deactivated  */
-	if j.build.version == j.refresh.version {
+	if j.build.version == j.refresh.version && !j.force {
 		// currently uptodate, nothing to do
 		log.Printf("job %s has already been built", j.name)
+		j.emit(format.EventType_BUILD_SKIPPED, &j.refresh, "already built")
 		return
 	}
 	/**/
@@ -155,72 +448,110 @@ func (j *job) Build() {
 	// I'm gonna run
 	// I'm under the protection of the lock
 	// mark the version has built
+	j.force = false
 	j.build.result = new(bytes.Buffer)
 	j.build.start = time.Now() // mark the job as started
+	j.stages = nil
+	j.notify()
+	j.emit(format.EventType_BUILD_STARTED, &j.refresh, "")
 	defer func() {
 		j.build.version = j.refresh.version
 		j.build.end = time.Now() // mark the job as ended at the end of this call.
+		j.archive()
+		j.notify()
+		j.emit(format.EventType_BUILD_FINISHED, &j.build, "")
 	}()
 
 	// do the job now and return
-	if err := j.dobuild(j.build.result); err != nil {
-		j.build.errcode = -1 // no semantic here... yet
-		fmt.Fprintln(j.build.result, err.Error())
+	w := j.redactor(j.writer(j.build.result))
+	defer w.Flush()
+	if err := j.dobuild(ctx, w); err != nil {
+		j.build.errcode = errcode(err)
+		fmt.Fprintln(w, err.Error())
 	} else {
 		j.build.errcode = 0
 	}
 	log.Printf("Done building job %s", j.name)
 
 }
-func (j *job) dobuild(w io.Writer) error {
 
-	wd, err := os.Getwd()
+//archive pushes the current build in the history.
+func (j *job) archive() {
+	x := j.build
+	x.result = nil // the history is meant to be small
+	j.history = append([]execution{x}, j.history...)
+	if len(j.history) > HistorySize {
+		j.history = j.history[:HistorySize]
+	}
+}
+
+//dobuild runs the job's pipeline file if any, or 'make ci'
+func (j *job) dobuild(ctx context.Context, w io.Writer) error {
+
+	wd, err := j.workdir()
 	if err != nil {
 		return err
 	}
 	fmt.Fprintf(w, "working dir: %s\n", wd)
+	dir := filepath.Join(wd, j.name)
 
-	fmt.Fprintf(w, "%s $ make ci\n", filepath.Join(wd, j.name))
-	return mrepo.Make(filepath.Join(wd, j.name), "ci", w)
+	p, err := readPipeline(dir)
+	if err != nil {
+		return err
+	}
+	if p != nil {
+		return p.run(ctx, j, dir, w)
+	}
+
+	// 'make ci' is run as a single stage, so that it can be cancelled too.
+	ci := stageSpec{Name: "ci", Commands: []string{"make ci"}}
+	return ci.run(ctx, dir, j.environ(), j.redactor(w))
 }
 
 //dorefresh actually run the refresh command, it is unsafe to call it without caution. It should only update errcode, and result
+//
+// The refresh runs in a child process, see refreshChild, with the job variables,
+// and git credentials, in its environment.
 func (j *job) dorefresh(w io.Writer) error {
-
-	// NB: this is  a mammoth function. I know it, but I wasn't able to
-	// split it down before having done everything.
-	//
-	// Step by step I will extract subffunctions to appropriate set of objects
-	//
-
-	wd, err := os.Getwd()
+	wd, err := j.workdir()
 	if err != nil {
 		return err
 	}
-	var cloned bool
-	_, err = os.Stat(j.name)
-	if os.IsNotExist(err) { // target does not exist, make it.
-		fmt.Fprintf(w, "job dir does not exists. Will create one: %s\n", j.name)
-		result, err := mrepo.GitClone(wd, j.name, j.remote, j.branch)
-		cloned = true //
-		fmt.Fprintln(w, result)
+	var env []string
+	if j.creds != nil {
+		creds, cleanup, err := j.creds.environ(j.name, j.remote)
 		if err != nil {
 			return err
 		}
+		defer cleanup()
+		env = creds
 	}
-
-	wk := mrepo.NewWorkspace(filepath.Join(wd, j.name))
-
-	if !cloned {
-		err := wk.PullTop(w)
-		if err != nil {
-			return err
-		}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
 	}
-	digest, err := wk.Refresh(w)
+	r, rw, err := os.Pipe()
 	if err != nil {
 		return err
 	}
-	copy(j.refresh.version[:], digest)
+	defer r.Close()
+
+	cmd := &exec.Cmd{Path: exe, Args: []string{refreshName, wd, j.name, j.remote, j.branch}}
+	cmd.Env = append(append(append([]string(nil), daemonEnviron...), j.environ()...), env...)
+	cmd.Stdout, cmd.Stderr = w, w
+	cmd.ExtraFiles = []*os.File{rw} // the child's fd 3
+	err = cmd.Start()
+	rw.Close()
+	if err != nil {
+		return err
+	}
+	result, _ := ioutil.ReadAll(r)
+	if err := cmd.Wait(); err != nil {
+		if _, failed := err.(*exec.ExitError); failed && len(result) > 0 {
+			return errors.New(string(result))
+		}
+		return err
+	}
+	copy(j.refresh.version[:], result)
 	return nil
 }
@@ -0,0 +1,187 @@
+package ci
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/ericaro/ci/format"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	//PipelineFile is the name of the file, at the root of the job's workspace, that declares the build stages.
+	PipelineFile = ".ci.yml"
+)
+
+//pipeline is the content of a PipelineFile:
+//
+//    stages:
+//      - name: test
+//        commands:
+//          - go vet ./...
+//          - go test ./...
+//        env:
+//          GOFLAGS: -v
+//        timeout: 10m
+//      - name: lint
+//        commands: [ golint ./... ]
+//        allow_failure: true
+//
+type pipeline struct {
+	Stages []stageSpec `yaml:"stages"`
+}
+
+//stageSpec declares a single stage.
+type stageSpec struct {
+	Name         string            `yaml:"name"`
+	Commands     []string          `yaml:"commands"`
+	Env          map[string]string `yaml:"env"`
+	Timeout      time.Duration     `yaml:"timeout"`       // no timeout if zero
+	AllowFailure bool              `yaml:"allow_failure"` // if true, a failure does not fail the build.
+}
+
+//readPipeline reads the PipelineFile in 'dir'. It returns nil, if there is no such file.
+func readPipeline(dir string) (*pipeline, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, PipelineFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p := new(pipeline)
+	if err := yaml.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %s", PipelineFile, err.Error())
+	}
+	if len(p.Stages) == 0 {
+		return nil, fmt.Errorf("%s declares no stages", PipelineFile)
+	}
+	for i, s := range p.Stages {
+		if s.Name == "" {
+			return nil, fmt.Errorf("%s: stage #%d has no name", PipelineFile, i)
+		}
+	}
+	return p, nil
+}
+
+//stage is the execution of a single stageSpec.
+type stage struct {
+	name         string
+	allowFailure bool
+	execution
+}
+
+//Status serialize the stage into a format.Stage.
+func (s *stage) Status(withResult bool) *format.Stage {
+	return &format.Stage{
+		Name:         &s.name,
+		AllowFailure: &s.allowFailure,
+		Execution:    s.execution.Status(withResult),
+	}
+}
+
+//Unmarshal restore a stage from a format.Stage message.
+func (s *stage) Unmarshal(f *format.Stage) error {
+	s.name = f.GetName()
+	s.allowFailure = f.GetAllowFailure()
+	return s.execution.Unmarshal(f.GetExecution())
+}
+
+//run executes all stages in 'dir', until one fails (and is not allowed to), or 'ctx' is done.
+//
+// Each stage output is written in its own execution, and in 'w'.
+func (p *pipeline) run(ctx context.Context, j *job, dir string, w io.Writer) error {
+	for _, spec := range p.Stages {
+		s := &stage{name: spec.Name, allowFailure: spec.AllowFailure}
+		s.version = j.refresh.version
+		s.result = new(bytes.Buffer)
+		s.start = time.Now()
+		j.stages = append(j.stages, s)
+
+		fmt.Fprintf(w, "\n--- stage %s\n", spec.Name)
+		err := spec.run(ctx, dir, j.environ(), j.redactor(io.MultiWriter(s.result, w)))
+		s.end = time.Now()
+		if err != nil {
+			s.errcode = errcode(err)
+			fmt.Fprintf(w, "--- stage %s failed: %s\n", spec.Name, err.Error())
+			if !spec.AllowFailure || err == errCancelled {
+				return &stageError{spec.Name, err}
+			}
+		}
+	}
+	return nil
+}
+
+//run executes the stage commands in 'dir', in order, and stops at the first failure.
+//
+// Commands run with the daemon environment, the job variables 'jobenv', and the
+// stage variables. They are killed when 'ctx' is done.
+func (spec *stageSpec) run(ctx context.Context, dir string, jobenv []string, w *redactor) error {
+	defer w.Flush()
+
+	if spec.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, spec.Timeout)
+		defer cancel()
+	}
+
+	env := append(append([]string(nil), daemonEnviron...), jobenv...)
+	keys := make([]string, 0, len(spec.Env))
+	for k := range spec.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, k+"="+spec.Env[k])
+	}
+
+	for _, c := range spec.Commands {
+		fmt.Fprintf(w, "%s $ %s\n", dir, c)
+		if ctx.Err() == context.Canceled {
+			return errCancelled
+		}
+		cmd := exec.CommandContext(ctx, "sh", "-c", c)
+		cmd.Dir = dir
+		cmd.Env = env
+		cmd.Stdout, cmd.Stderr = w, w
+		// commands are run in their own process group, so that a timeout kills them all.
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		cmd.Cancel = func() error { return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) }
+		if err := cmd.Run(); err != nil {
+			switch ctx.Err() {
+			case context.DeadlineExceeded:
+				return errTimedOut(spec.Timeout)
+			case context.Canceled:
+				return errCancelled
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+//stageError is the error of the stage that failed the build.
+type stageError struct {
+	name string
+	err  error
+}
+
+func (e *stageError) Error() string { return fmt.Sprintf("stage %s failed: %s", e.name, e.err.Error()) }
+
+//errCancelled is returned by an execution that has been cancelled.
+var errCancelled = errors.New("cancelled")
+
+//errTimedOut is returned by a stage that took more than its timeout.
+type errTimedOut time.Duration
+
+func (e errTimedOut) Error() string { return fmt.Sprintf("timed out after %v", time.Duration(e)) }
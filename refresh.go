@@ -0,0 +1,71 @@
+package ci
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ericaro/mrepo"
+)
+
+//refreshName is the process name of refresh children, see refreshChild.
+const refreshName = "ci-refresh"
+
+func init() {
+	// a refresh child runs before the program's main, and exits.
+	if len(os.Args) == 5 && os.Args[0] == refreshName {
+		os.Exit(refreshChild(os.Args[1], os.Args[2], os.Args[3], os.Args[4]))
+	}
+}
+
+//refreshChild clones or pulls the job 'name' in 'wd', and refreshes its
+// subrepositories. It is the main of a child process started by the daemon
+// program itself (see job.dorefresh), so that git runs with the job environment,
+// without the daemon environment ever holding it.
+//
+// Outputs go to stdout. The version digest, or the error message, is written
+// to the file descriptor 3. It returns the process exit code.
+func refreshChild(wd, name, remote, branch string) int {
+	result := os.NewFile(3, "result")
+	digest, err := refresh(os.Stdout, wd, name, remote, branch)
+	if err != nil {
+		fmt.Fprint(result, err.Error())
+		return 1
+	}
+	result.Write(digest)
+	return 0
+}
+
+//refresh clones or pulls the job 'name' in 'wd', refreshes its subrepositories,
+// and returns the version digest.
+func refresh(w io.Writer, wd, name, remote, branch string) ([]byte, error) {
+
+	// NB: this is  a mammoth function. I know it, but I wasn't able to
+	// split it down before having done everything.
+	//
+	// Step by step I will extract subffunctions to appropriate set of objects
+	//
+
+	var cloned bool
+	_, err := os.Stat(filepath.Join(wd, name))
+	if os.IsNotExist(err) { // target does not exist, make it.
+		fmt.Fprintf(w, "job dir does not exists. Will create one: %s\n", name)
+		result, err := mrepo.GitClone(wd, name, remote, branch)
+		cloned = true //
+		fmt.Fprintln(w, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	wk := mrepo.NewWorkspace(filepath.Join(wd, name))
+
+	if !cloned {
+		err := wk.PullTop(w)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return wk.Refresh(w)
+}
@@ -0,0 +1,45 @@
+package ci
+
+import (
+	"sync"
+	"time"
+)
+
+//revisions is the daemon job state revision: it increases on every change of
+// any job, and each job records the revision of its last change.
+//
+// It starts at the daemon start time (in ns), so that revisions keep increasing
+// across restarts, and clients can tell a revision from a previous run.
+type revisions struct {
+	mu      sync.Mutex
+	start   uint64        // the revision when the daemon started
+	current uint64        // the last revision
+	changed chan struct{} // closed on the next revision, see get()
+}
+
+func newRevisions() *revisions {
+	start := uint64(time.Now().UnixNano())
+	return &revisions{start: start, current: start}
+}
+
+//next increases the revision, and returns it.
+func (r *revisions) next() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current++
+	if r.changed != nil {
+		close(r.changed)
+		r.changed = nil
+	}
+	return r.current
+}
+
+//get returns the start, and current revision, and a channel closed on the next one.
+func (r *revisions) get() (start, current uint64, changed <-chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.changed == nil {
+		r.changed = make(chan struct{})
+	}
+	return r.start, r.current, r.changed
+}
@@ -0,0 +1,166 @@
+package ci
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+)
+
+//Redacted replaces secret values in the job outputs.
+const Redacted = "***"
+
+//sealer encrypts the job secrets at rest, with AES-256-GCM and the daemon key.
+type sealer struct {
+	aead cipher.AEAD
+}
+
+//loadKey reads the daemon key in 'filename', or creates it if there is none.
+//
+// The key file is the only way to read the secrets in the db: losing it loses
+// them, copying it along with the db gives them away.
+func loadKey(filename string) (*sealer, error) {
+	key, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		key = make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(filename, key, 0600); err != nil {
+			return nil, err
+		}
+		log.Printf("daemon.key.created:%q", filename)
+	} else if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, errors.New("invalid key file " + filename + ": expecting 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &sealer{aead: aead}, nil
+}
+
+//seal encrypts 'value'. The sealed value can only be opened for the same 'name'.
+func (s *sealer) seal(name, value string) []byte {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		panic(err) // the system random source is broken
+	}
+	return s.aead.Seal(nonce, nonce, []byte(value), []byte(name))
+}
+
+//open decrypts a value sealed for 'name'.
+func (s *sealer) open(name string, sealed []byte) (string, error) {
+	n := s.aead.NonceSize()
+	if len(sealed) < n {
+		return "", errors.New("sealed value too short")
+	}
+	value, err := s.aead.Open(nil, sealed[:n], sealed[n:], []byte(name))
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+//environ returns the job variables, then secrets, as "name=value".
+func (j *job) environ() []string {
+	env := make([]string, 0, len(j.env)+len(j.secrets))
+	for _, m := range []map[string]string{j.env, j.secrets} {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			env = append(env, k+"="+m[k])
+		}
+	}
+	return env
+}
+
+//redactor returns a writer that writes to 'w', with the job's secret values,
+// and its git credentials, replaced by Redacted. It must be flushed at the end.
+func (j *job) redactor(w io.Writer) *redactor {
+	r := &redactor{w: w}
+	values := make([]string, 0, len(j.secrets))
+	for _, v := range j.secrets {
+		values = append(values, v)
+	}
+	if j.creds != nil {
+		values = append(values, j.creds.secrets(j.name, j.remote)...)
+	}
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		r.secrets = append(r.secrets, []byte(v))
+		if len(v) > r.max {
+			r.max = len(v)
+		}
+	}
+	// replace longer secrets first, in case one contains another.
+	sort.Slice(r.secrets, func(a, b int) bool { return len(r.secrets[a]) > len(r.secrets[b]) })
+	return r
+}
+
+//redactor replaces secrets in a stream. It holds back the last bytes written,
+// that could be the beginning of a secret, until the next write, or Flush.
+type redactor struct {
+	w       io.Writer
+	secrets [][]byte
+	max     int    // the longest secret length
+	pending []byte // written, but not passed on yet
+}
+
+func (r *redactor) Write(p []byte) (int, error) {
+	if len(r.secrets) == 0 {
+		return r.w.Write(p)
+	}
+	buf := r.redact(append(r.pending, p...))
+	keep := r.max - 1
+	if keep > len(buf) {
+		keep = len(buf)
+	}
+	r.pending = append([]byte(nil), buf[len(buf)-keep:]...)
+	if _, err := r.w.Write(buf[:len(buf)-keep]); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+//Flush writes the pending bytes.
+func (r *redactor) Flush() error {
+	if len(r.pending) == 0 {
+		return nil
+	}
+	_, err := r.w.Write(r.redact(r.pending))
+	r.pending = nil
+	return err
+}
+
+//String redacts 's'.
+func (r *redactor) String(s string) string { return string(r.redact([]byte(s))) }
+
+func (r *redactor) redact(b []byte) []byte {
+	for _, s := range r.secrets {
+		b = bytes.Replace(b, s, []byte(Redacted), -1)
+	}
+	return b
+}
+
+//daemonEnviron is the daemon environment at startup. Child processes get it,
+// along with the job variables: they are never set in the daemon environment.
+var daemonEnviron = os.Environ()
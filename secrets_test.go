@@ -0,0 +1,132 @@
+package ci
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//tempDir returns a new temporary directory, and a function to remove it.
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "ci-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestLoadKey(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	filename := filepath.Join(dir, "ci.db.key")
+
+	s, err := loadKey(filename)
+	if err != nil {
+		t.Fatalf("cannot create the key: %v", err)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("key file not created: %v", err)
+	}
+	if info.Size() != 32 || info.Mode().Perm() != 0600 {
+		t.Errorf("key file: got %d bytes, mode %v, want 32 bytes, mode 0600", info.Size(), info.Mode().Perm())
+	}
+	sealed := s.seal("job/TOKEN", "s3cr3t")
+	if bytes.Contains(sealed, []byte("s3cr3t")) {
+		t.Errorf("sealed value contains the secret")
+	}
+
+	// the key is read again on restart, and opens what was sealed before.
+	s, err = loadKey(filename)
+	if err != nil {
+		t.Fatalf("cannot read the key: %v", err)
+	}
+	if v, err := s.open("job/TOKEN", sealed); err != nil || v != "s3cr3t" {
+		t.Errorf("open: got %q, %v, want %q", v, err, "s3cr3t")
+	}
+
+	// another key file is another key.
+	other, err := loadKey(filepath.Join(dir, "other.key"))
+	if err != nil {
+		t.Fatalf("cannot create the other key: %v", err)
+	}
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 1
+
+	for _, x := range []struct {
+		name   string
+		s      *sealer
+		ad     string
+		sealed []byte
+	}{
+		{"other name", s, "job/OTHER", sealed},
+		{"other key", other, "job/TOKEN", sealed},
+		{"tampered", s, "job/TOKEN", tampered},
+		{"truncated", s, "job/TOKEN", sealed[:4]},
+	} {
+		if v, err := x.s.open(x.ad, x.sealed); err == nil {
+			t.Errorf("%s: opened %q, want an error", x.name, v)
+		}
+	}
+}
+
+func TestLoadKeyInvalid(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	filename := filepath.Join(dir, "ci.db.key")
+	if err := ioutil.WriteFile(filename, []byte("too short"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadKey(filename); err == nil {
+		t.Errorf("loaded a key of %d bytes, want an error", len("too short"))
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	for _, x := range []struct {
+		name    string
+		secrets map[string]string
+		writes  []string
+		want    string
+	}{
+		{"no secret", nil, []string{"hello ", "world"}, "hello world"},
+		{"one write", map[string]string{"A": "s3cr3t"}, []string{"token=s3cr3t\n"}, "token=***\n"},
+		{"split", map[string]string{"A": "s3cr3t"}, []string{"token=s3", "cr", "3t\n"}, "token=***\n"},
+		{"at the end", map[string]string{"A": "s3cr3t"}, []string{"token=s3cr3t"}, "token=***"},
+		{"prefix only", map[string]string{"A": "s3cr3t"}, []string{"s3cr", "\ns3cr"}, "s3cr\ns3cr"},
+		{"repeated", map[string]string{"A": "s3cr3t"}, []string{"s3cr3ts3c", "r3t"}, "******"},
+		{"overlapping", map[string]string{"A": "abc", "B": "abcdef"}, []string{"abcdef abc", " ab", "c"}, "*** *** ***"},
+		{"empty value", map[string]string{"A": "", "B": "s3cr3t"}, []string{"a s3cr3t"}, "a ***"},
+	} {
+		var buf bytes.Buffer
+		r := (&job{secrets: x.secrets}).redactor(&buf)
+		for _, w := range x.writes {
+			n, err := r.Write([]byte(w))
+			if n != len(w) || err != nil {
+				t.Errorf("%s: Write(%q) = %d, %v", x.name, w, n, err)
+			}
+			if len(r.pending) >= len("abcdef") {
+				t.Errorf("%s: %d bytes held back, want less than the longest secret", x.name, len(r.pending))
+			}
+		}
+		if err := r.Flush(); err != nil {
+			t.Errorf("%s: Flush: %v", x.name, err)
+		}
+		if got := buf.String(); got != x.want {
+			t.Errorf("%s: got %q, want %q", x.name, got, x.want)
+		}
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	j := &job{
+		env:     map[string]string{"B": "2", "A": "1"},
+		secrets: map[string]string{"TOKEN": "s3cr3t"},
+	}
+	if got, want := strings.Join(j.environ(), " "), "A=1 B=2 TOKEN=s3cr3t"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}